@@ -74,10 +74,21 @@ func (p Phase) String() string {
 	case Externalize:
 		return "Externalize"
 	default:
-		panic(fmt.Sprintf("unknown phase: %+v", p))
+		// String runs inside logging, so a bad value must not panic
+		return fmt.Sprintf("Phase(%d)", int(p))
 	}
 }
 
+// ParsePhase is the inverse of Phase.String. Invalid is never parsed.
+func ParsePhase(s string) (Phase, error) {
+	for _, p := range []Phase{Prepare, Confirm, Externalize} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return Invalid, fmt.Errorf("unknown phase: %s", s)
+}
+
 type Ballot struct {
 	// An increasing counter, n >= 1, to ensure we can always have more ballots
 	n int
@@ -86,10 +97,47 @@ type Ballot struct {
 	x SlotValue
 }
 
+// NewBallot returns an error if n is not a valid ballot counter.
+func NewBallot(n int, x SlotValue) (*Ballot, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("ballot counter must be at least 1, got %d", n)
+	}
+	return &Ballot{n: n, x: x}, nil
+}
+
+// Counter returns n, the ballot counter.
+func (b *Ballot) Counter() int {
+	return b.n
+}
+
+// Value returns x, the value this ballot proposes.
+func (b *Ballot) Value() SlotValue {
+	return b.x
+}
+
 func (b *Ballot) String() string {
 	return fmt.Sprintf("(%d,%s)", b.n, util.Shorten(string(b.x)))
 }
 
+// LessThan orders ballots lexicographically by (n, x), as in the protocol.
+// A nil ballot is less than any non-nil ballot.
+func (b *Ballot) LessThan(other *Ballot) bool {
+	if b == nil || other == nil {
+		return b == nil && other != nil
+	}
+	if b.n != other.n {
+		return b.n < other.n
+	}
+	return b.x < other.x
+}
+
+func (b *Ballot) Equals(other *Ballot) bool {
+	if b == nil || other == nil {
+		return b == nil && other == nil
+	}
+	return b.n == other.n && b.x == other.x
+}
+
 // Whether accepting a as prepared implies b is accepted as prepared
 func gtecompat(a *Ballot, b *Ballot) bool {
 	if a == nil || b == nil {
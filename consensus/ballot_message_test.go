@@ -0,0 +1,171 @@
+package consensus
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"coinkit/util"
+)
+
+func TestBallotOrdering(t *testing.T) {
+	a := &Ballot{n: 2, x: SlotValue("a")}
+	b := &Ballot{n: 2, x: SlotValue("b")}
+	c := &Ballot{n: 3, x: SlotValue("a")}
+	if !a.LessThan(b) || b.LessThan(a) {
+		t.Fatal("equal counters should be ordered by value")
+	}
+	if !b.LessThan(c) || c.LessThan(b) {
+		t.Fatal("the counter should take precedence over the value")
+	}
+	if a.LessThan(a) {
+		t.Fatal("a ballot should not be less than itself")
+	}
+	if !a.Equals(&Ballot{n: 2, x: SlotValue("a")}) {
+		t.Fatal("identical ballots should be equal")
+	}
+	if a.Equals(b) || a.Equals(c) {
+		t.Fatal("different ballots should not be equal")
+	}
+}
+
+func TestPhaseNames(t *testing.T) {
+	for _, p := range []Phase{Prepare, Confirm, Externalize} {
+		p2, err := ParsePhase(p.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p2 != p {
+			t.Fatalf("%s parsed as %s", p, p2)
+		}
+	}
+	for _, name := range []string{"Bogus", "Invalid", "prepare"} {
+		if _, err := ParsePhase(name); err == nil {
+			t.Fatalf("parsing %s should be an error", name)
+		}
+	}
+
+	unknown := Phase(17)
+	if unknown.String() != "Phase(17)" {
+		t.Fatalf("bad name for an unknown phase: %s", unknown)
+	}
+	if _, err := ParsePhase(unknown.String()); err == nil {
+		t.Fatal("the name of an unknown phase should not parse")
+	}
+}
+
+func TestNewBallot(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if _, err := NewBallot(n, SlotValue("a")); err == nil {
+			t.Fatalf("a ballot counter of %d should be rejected", n)
+		}
+	}
+	b, err := NewBallot(3, SlotValue("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Counter() != 3 || b.Value() != SlotValue("a") {
+		t.Fatalf("bad ballot: %s", b)
+	}
+}
+
+func TestNilBallotOrdering(t *testing.T) {
+	var none *Ballot
+	b := &Ballot{n: 1, x: SlotValue("a")}
+	if !none.LessThan(b) {
+		t.Fatal("nil should sort below a non-nil ballot")
+	}
+	if b.LessThan(none) || none.LessThan(none) {
+		t.Fatal("nothing should sort below nil")
+	}
+	if !none.Equals(nil) || none.Equals(b) || b.Equals(none) {
+		t.Fatal("nil should only equal nil")
+	}
+}
+
+func TestConsensusMessageEncoding(t *testing.T) {
+	qs, _ := MakeTestQuorumSlice(4)
+	nm := &NominationMessage{
+		I:   3,
+		Nom: []SlotValue{"a", "b"},
+		Acc: []SlotValue{"a"},
+		D:   qs,
+	}
+	pm := &PrepareMessage{
+		I:   3,
+		Bn:  4,
+		Bx:  "b",
+		Pn:  3,
+		Px:  "b",
+		Ppn: 2,
+		Ppx: "a",
+		Cn:  1,
+		Hn:  3,
+		D:   qs,
+	}
+	cm := &ConfirmMessage{I: 3, X: "b", Pn: 4, Cn: 2, Hn: 4, D: qs}
+	em := &ExternalizeMessage{I: 3, X: "b", Cn: 2, Hn: 4, D: qs}
+
+	nm2, ok := util.EncodeThenDecode(nm).(*NominationMessage)
+	if !ok || !reflect.DeepEqual(nm, nm2) {
+		t.Fatalf("bad nomination decode: %+v", nm2)
+	}
+	pm2, ok := util.EncodeThenDecode(pm).(*PrepareMessage)
+	if !ok || !reflect.DeepEqual(pm, pm2) {
+		t.Fatalf("bad prepare decode: %+v", pm2)
+	}
+	cm2, ok := util.EncodeThenDecode(cm).(*ConfirmMessage)
+	if !ok || !reflect.DeepEqual(cm, cm2) {
+		t.Fatalf("bad confirm decode: %+v", cm2)
+	}
+	em2, ok := util.EncodeThenDecode(em).(*ExternalizeMessage)
+	if !ok || !reflect.DeepEqual(em, em2) {
+		t.Fatalf("bad externalize decode: %+v", em2)
+	}
+}
+
+func TestMessagesEqual(t *testing.T) {
+	qs, _ := MakeTestQuorumSlice(4)
+	makePrepare := func() *PrepareMessage {
+		return &PrepareMessage{I: 3, Bn: 4, Bx: "b", Pn: 3, Px: "b", Cn: 1, Hn: 3, D: qs}
+	}
+	a := makePrepare()
+	b := makePrepare()
+	if !util.MessagesEqual(a, b) {
+		t.Fatal("identical prepare messages should be equal")
+	}
+	b.Cn = 2
+	if util.MessagesEqual(a, b) {
+		t.Fatal("prepare messages with different Cn should not be equal")
+	}
+	b = makePrepare()
+	b.D.Threshold = 4
+	if util.MessagesEqual(a, b) {
+		t.Fatal("prepare messages with different D should not be equal")
+	}
+	c := &ConfirmMessage{I: 3, X: "b", Pn: 4, Cn: 1, Hn: 3, D: qs}
+	if util.MessagesEqual(a, c) {
+		t.Fatal("messages of different types should not be equal")
+	}
+}
+
+func TestSlotValueDelimitersSurviveEncoding(t *testing.T) {
+	qs, _ := MakeTestQuorumSlice(4)
+	odd := SlotValue("a,b\nc:d\"e")
+	nm := &NominationMessage{I: 1, Nom: []SlotValue{odd, "x"}, D: qs}
+
+	// Check the signed wire format too, since it is line- and colon-delimited
+	kp := util.NewKeyPairFromSecretPhrase("delimiters")
+	line := util.NewSignedMessage(kp, nm).Serialize()
+	if strings.Contains(line, "\n") {
+		t.Fatal("a serialized message should be a single line")
+	}
+	sm, err := util.NewSignedMessageFromSerialized(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm2, ok := sm.Message().(*NominationMessage)
+	if !ok || !reflect.DeepEqual(nm, nm2) {
+		t.Fatalf("bad nomination decode: %+v", sm.Message())
+	}
+}
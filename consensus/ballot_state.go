@@ -104,6 +104,11 @@ func (s *BallotState) Show() {
 	}
 }
 
+// Phase returns which phase of balloting we are in
+func (s *BallotState) Phase() Phase {
+	return s.phase
+}
+
 func (s *BallotState) PublicKey() util.PublicKey {
 	return s.publicKey
 }
@@ -446,6 +451,18 @@ func (s *BallotState) GoToNextBallot() bool {
 	return true
 }
 
+// Timeout should be called by a scheduler when the current round of balloting
+// has gone on too long. It moves to the next ballot number, using z as the
+// value when we have one, as described on page 24 of the paper.
+// Once we are externalizing there is nothing to time out.
+// Returns whether we changed the ballot.
+func (s *BallotState) Timeout() bool {
+	if s.phase == Externalize {
+		return false
+	}
+	return s.GoToNextBallot()
+}
+
 // CheckForBlockedBallot returns whether we ended up changing the state.
 // We bump the ballot number if the set of nodes that could never vote
 // for our ballot is blocking, and we have a candidate value.
@@ -0,0 +1,109 @@
+package consensus
+
+import (
+	"testing"
+
+	"coinkit/util"
+)
+
+// Makes ballot states for a 3-of-4 quorum that all nominate the same value
+func ballotCluster() []*BallotState {
+	qs, names := MakeTestQuorumSlice(4)
+	states := []*BallotState{}
+	for _, name := range names {
+		vs := NewTestValueStore(0)
+		nState := NewNominationState(name, qs, vs)
+		nState.NominateNewValue(SlotValue("hello"))
+		bState := NewBallotState(name, qs, nState)
+		bState.GoToNextBallot()
+		states = append(states, bState)
+	}
+	return states
+}
+
+func exchangeBallots(states []*BallotState) {
+	for _, source := range states {
+		m := util.EncodeThenDecode(source.Message(1, source.D))
+		for _, target := range states {
+			if source != target {
+				target.Handle(source.publicKey.String(), m.(BallotMessage))
+			}
+		}
+	}
+}
+
+func TestBallotStateExternalizes(t *testing.T) {
+	states := ballotCluster()
+	for _, s := range states {
+		if s.Phase() != Prepare {
+			t.Fatalf("expected to start in prepare, got %s", s.Phase())
+		}
+	}
+
+	// Only three of the four nodes talk, which should still be a quorum
+	active := states[0:3]
+	for i := 0; i < 5; i++ {
+		exchangeBallots(active)
+	}
+	for _, s := range active {
+		if s.Phase() != Externalize {
+			t.Fatalf("expected to externalize, got %s", s.Phase())
+		}
+		if s.b.x != SlotValue("hello") {
+			t.Fatalf("externalized the wrong value: %s", s.b.x)
+		}
+		s.AssertValid()
+	}
+	if states[3].Phase() != Prepare {
+		t.Fatal("a node that heard nothing should not advance")
+	}
+}
+
+func TestBallotStateNeedsQuorum(t *testing.T) {
+	states := ballotCluster()
+
+	// Two of the four nodes are not enough to commit anything
+	active := states[0:2]
+	for i := 0; i < 5; i++ {
+		exchangeBallots(active)
+	}
+	for _, s := range active {
+		if s.Phase() != Prepare {
+			t.Fatalf("advanced to %s without a quorum", s.Phase())
+		}
+	}
+}
+
+func TestBallotStateTimeout(t *testing.T) {
+	states := ballotCluster()
+	s := states[0]
+	if s.b == nil || s.b.n != 1 {
+		t.Fatalf("expected to start on ballot 1, got %+v", s.b)
+	}
+
+	// Without z, the timeout uses the nominated value
+	if !s.Timeout() || s.b.n != 2 || s.b.x != SlotValue("hello") {
+		t.Fatalf("bad ballot after a timeout: %+v", s.b)
+	}
+
+	z := SlotValue("prepared")
+	s.z = &z
+	last := s.b.n
+	for i := 0; i < 5; i++ {
+		if !s.Timeout() {
+			t.Fatal("timing out should change the ballot")
+		}
+		if s.b.n <= last {
+			t.Fatalf("ballot number went from %d to %d", last, s.b.n)
+		}
+		if s.b.x != z {
+			t.Fatalf("timeout should carry z forward, got %s", s.b.x)
+		}
+		last = s.b.n
+	}
+
+	s.phase = Externalize
+	if s.Timeout() || s.b.n != last {
+		t.Fatal("an externalized ballot should not time out")
+	}
+}
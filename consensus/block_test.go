@@ -14,8 +14,11 @@ import (
 func TestSolipsistQuorum(t *testing.T) {
 	vs := NewTestValueStore(1)
 	kp := util.NewKeyPairFromSecretPhrase("foo")
-	s := NewBlock(kp.PublicKey(),
-		MakeQuorumSlice([]string{kp.PublicKey().String()}, 1), 1, vs)
+	qs, err := MakeQuorumSlice([]string{kp.PublicKey().String()}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewBlock(kp.PublicKey(), qs, 1, vs)
 	if !MeetsQuorum(s.nState, []string{kp.PublicKey().String()}) {
 		t.Fatal("known public key should meet the quorum")
 	}
@@ -35,7 +38,10 @@ func TestConsensus(t *testing.T) {
 		cpk.String(),
 		dpk.String(),
 	}
-	qs := MakeQuorumSlice(members, 3)
+	qs, err := MakeQuorumSlice(members, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
 	vs := NewTestValueStore(0)
 	amy := NewBlock(apk, qs, 1, vs)
 	bob := NewBlock(bpk, qs, 1, vs)
@@ -131,7 +137,10 @@ func TestProtectionAgainstBigRangeDDoS(t *testing.T) {
 		dpk.String(),
 	}
 
-	qs := MakeQuorumSlice(members, 3)
+	qs, err := MakeQuorumSlice(members, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
 	vs := NewTestValueStore(0)
 
 	blocks := []*Block{
@@ -271,3 +280,60 @@ func TestBlockOneNodeKnockedOut(t *testing.T) {
 		blockFuzzTest(knockout, i, t)
 	}
 }
+
+func TestNewBlockHandlesPrepare(t *testing.T) {
+	qs, names := MakeTestQuorumSlice(4)
+	block := NewBlock(names[0], qs, 1, NewTestValueStore(0))
+	m := &PrepareMessage{
+		I:  1,
+		Bn: 1,
+		Bx: SlotValue("foo"),
+		D:  qs,
+	}
+	block.Handle(names[1].String(), m)
+	if len(block.bState.M) != 1 {
+		t.Fatal("the prepare message should have been recorded")
+	}
+}
+
+func TestBlockOutgoingMessages(t *testing.T) {
+	qs, names := MakeTestQuorumSlice(4)
+	vs := NewTestValueStore(0)
+	var waiting *Block
+	for _, name := range names {
+		block := NewBlock(name, qs, 3, vs)
+		if !block.nState.HasNomination() {
+			waiting = block
+			break
+		}
+	}
+	if waiting == nil {
+		t.Fatal("expected some block to wait for its turn to nominate")
+	}
+
+	// With nothing nominated we still send a blank nomination
+	messages := waiting.OutgoingMessages()
+	if len(messages) != 1 {
+		t.Fatalf("expected one message but got %d", len(messages))
+	}
+	if _, ok := messages[0].(*NominationMessage); !ok {
+		t.Fatalf("expected a nomination message but got %s", messages[0])
+	}
+
+	// Once we have a value we can start balloting on it
+	waiting.nState.NominateNewValue(SlotValue("foo"))
+	messages = waiting.OutgoingMessages()
+	if len(messages) != 2 {
+		t.Fatalf("expected two messages but got %d", len(messages))
+	}
+	p, ok := messages[1].(*PrepareMessage)
+	if !ok {
+		t.Fatalf("expected a prepare message but got %s", messages[1])
+	}
+	if p.I != 3 || p.Bn != 1 || p.Bx != SlotValue("foo") {
+		t.Fatalf("unexpected prepare message: %s", p)
+	}
+	if p.D.Threshold != qs.Threshold || len(p.D.Members) != len(qs.Members) {
+		t.Fatalf("prepare message has the wrong quorum slice: %+v", p.D)
+	}
+}
@@ -8,6 +8,10 @@ import (
 	"coinkit/util"
 )
 
+// DefaultSlotWindow is how many slots ahead of the current one a chain will
+// accept messages for, by default.
+const DefaultSlotWindow = 10
+
 // Chain creates the blockchain, gaining consensus on one Block at a time.
 // Chain is not threadsafe.
 type Chain struct {
@@ -21,10 +25,47 @@ type Chain struct {
 	// The quorum logic we use for future blocks
 	D QuorumSlice
 
+	// Messages for slots more than SlotWindow ahead of the current slot
+	// are dropped
+	SlotWindow int
+
+	// Messages whose quorum slice has more members than this are dropped
+	MaxQuorumMembers int
+
 	// Who we are
 	publicKey util.PublicKey
 
 	values ValueStore
+
+	// The number of times Tick has been called
+	ticks int
+
+	// The tick when we last made progress, and what our progress was then
+	progressTick int
+	lastProgress chainProgress
+
+	// If set, OnPhaseChange is called whenever the ballot phase for a slot
+	// changes, and OnExternalize is called when a slot externalizes.
+	// They are called synchronously from Handle, so they should be quick.
+	OnPhaseChange func(slot int, old, new Phase)
+	OnExternalize func(slot int, v SlotValue)
+
+	// The latest quorum slice advertised by each node, including us
+	quorums *QuorumMap
+}
+
+// chainProgress summarizes how far along a chain is, for detecting when it's
+// stuck.
+type chainProgress struct {
+	slot      int
+	phase     Phase
+	accepted  int
+	confirmed int
+}
+
+// quorumSliceMessage is a message that carries its sender's quorum slice.
+type quorumSliceMessage interface {
+	QuorumSlice() QuorumSlice
 }
 
 func (c *Chain) Logf(format string, a ...interface{}) {
@@ -41,8 +82,24 @@ func (c *Chain) Handle(sender string, message util.Message) util.Message {
 	}
 
 	slot := message.Slot()
-	if slot == 0 {
-		log.Fatalf("slot should not be zero in %s", message)
+	if slot < 1 || slot > c.current.slot+c.SlotWindow {
+		// Peers shouldn't be able to make us track arbitrary slots
+		c.Logf("dropping message for slot %d: %s", slot, message)
+		return nil
+	}
+
+	// Check the sender's quorum slice before it gets into any of our state
+	if m, ok := message.(quorumSliceMessage); ok {
+		qs := m.QuorumSlice()
+		if err := qs.Validate(c.MaxQuorumMembers); err != nil {
+			c.Logf("dropping message with a bad quorum slice: %s", err)
+			return nil
+		}
+		if !c.isKnown(sender) {
+			c.Logf("dropping message from unknown node %s", util.Shorten(sender))
+			return nil
+		}
+		c.quorums.Update(sender, slot, qs)
 	}
 
 	// Handle info messages
@@ -55,13 +112,20 @@ func (c *Chain) Handle(sender string, message util.Message) util.Message {
 	}
 
 	if slot == c.current.slot {
+		phase := c.current.bState.phase
 		c.current.Handle(sender, message)
+		if c.current.bState.phase != phase && c.OnPhaseChange != nil {
+			c.OnPhaseChange(slot, phase, c.current.bState.phase)
+		}
 		if c.current.Done() && c.values.CanFinalize(c.current.external.X) {
 			// This block is done, let's move on to the next one
 			c.Logf("advancing to slot %d", slot+1)
 			c.values.Finalize(c.current.external.X)
 			c.history[slot] = c.current
 			c.current = NewBlock(c.publicKey, c.D, slot+1, c.values)
+			if c.OnExternalize != nil {
+				c.OnExternalize(slot, c.history[slot].external.X)
+			}
 		}
 		return nil
 	}
@@ -83,6 +147,31 @@ func (c *Chain) Handle(sender string, message util.Message) util.Message {
 	return nil
 }
 
+// isKnown returns whether we accept consensus messages from node.
+// That is the members of our quorum slice, and the members of their latest
+// quorum slices. It goes no further, so strangers can't vouch for strangers,
+// and a node stops being known when our members drop it.
+func (c *Chain) isKnown(node string) bool {
+	members := c.D.AllMembers()
+	for _, member := range members {
+		if member == node {
+			return true
+		}
+	}
+	for _, member := range members {
+		qs, ok := c.quorums.Get(member)
+		if !ok {
+			continue
+		}
+		for _, x := range qs.AllMembers() {
+			if x == node {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *Chain) AssertValid() {
 	c.current.AssertValid()
 }
@@ -92,14 +181,72 @@ func (c *Chain) Slot() int {
 	return c.current.slot
 }
 
+func (c *Chain) progress() chainProgress {
+	return chainProgress{
+		slot:      c.current.slot,
+		phase:     c.current.bState.phase,
+		accepted:  len(c.current.nState.Y),
+		confirmed: len(c.current.nState.Z),
+	}
+}
+
+// Tick should be called periodically by whatever is running the chain.
+// It is how Stuck measures time.
+func (c *Chain) Tick() {
+	c.ticks++
+	if p := c.progress(); p != c.lastProgress {
+		c.lastProgress = p
+		c.progressTick = c.ticks
+	}
+}
+
+// Stuck returns whether we have made no progress for at least sinceTicks
+// ticks. Progress is moving to a new slot or ballot phase, or accepting or
+// confirming a new nomination.
+func (c *Chain) Stuck(sinceTicks int) bool {
+	return c.ticks-c.progressTick >= sinceTicks
+}
+
+// Quorums returns the latest quorum slice we have seen from each node.
+func (c *Chain) Quorums() *QuorumMap {
+	return c.quorums
+}
+
+// ExternalizedValue returns the value agreed on for a finished slot.
+// The bool is false if the slot has not externalized yet.
+func (c *Chain) ExternalizedValue(slot int) (SlotValue, bool) {
+	block := c.history[slot]
+	if block == nil {
+		return SlotValue(""), false
+	}
+	return block.external.X, true
+}
+
+// ExternalizeMessage returns the externalize message for a finished slot, or
+// nil if the slot has not externalized yet.
+func (c *Chain) ExternalizeMessage(slot int) *ExternalizeMessage {
+	block := c.history[slot]
+	if block == nil {
+		return nil
+	}
+	return block.external
+}
+
 func NewEmptyChain(publicKey util.PublicKey, qs QuorumSlice, vs ValueStore) *Chain {
-	return &Chain{
-		current:   NewBlock(publicKey, qs, 1, vs),
-		history:   make(map[int]*Block),
-		D:         qs,
-		values:    vs,
-		publicKey: publicKey,
+	quorums := NewQuorumMap()
+	quorums.Update(publicKey.String(), 0, qs)
+	chain := &Chain{
+		current:          NewBlock(publicKey, qs, 1, vs),
+		history:          make(map[int]*Block),
+		D:                qs,
+		SlotWindow:       DefaultSlotWindow,
+		MaxQuorumMembers: DefaultMaxQuorumMembers,
+		values:           vs,
+		publicKey:        publicKey,
+		quorums:          quorums,
 	}
+	chain.lastProgress = chain.progress()
+	return chain
 }
 
 // ValueStoreUpdated should be called when the value store is updated
@@ -107,6 +254,11 @@ func (c *Chain) ValueStoreUpdated() {
 	c.current.ValueStoreUpdated()
 }
 
+// OutgoingMessages returns the messages for the slot we are working on, plus
+// the externalize message for the slot before it.
+// Since we only work on the slot after the last one we externalized, the
+// slot numbers on these messages tell peers how far along we are. A peer
+// that is behind gets caught up when we handle its messages for old slots.
 func (c *Chain) OutgoingMessages() []util.Message {
 	answer := c.current.OutgoingMessages()
 
@@ -1,8 +1,10 @@
 package consensus
 
 import (
+	"fmt"
 	"log"
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"coinkit/util"
@@ -112,3 +114,308 @@ func TestChainOneNodeKnockedOut(t *testing.T) {
 		chainFuzzTest(knockout, i, t)
 	}
 }
+
+func TestChainExternalizedValue(t *testing.T) {
+	chains := chainCluster(4)
+	for i := 0; i < 10 && progress(chains) < 1; i++ {
+		for _, source := range chains {
+			for _, target := range chains {
+				chainSend(source, target)
+			}
+		}
+	}
+	for _, chain := range chains {
+		if chain.Slot() != 2 {
+			t.Fatalf("expected to advance to slot 2 but got %d", chain.Slot())
+		}
+		v, ok := chain.ExternalizedValue(1)
+		if !ok {
+			t.Fatal("slot 1 should have an externalized value")
+		}
+		first, _ := chains[0].ExternalizedValue(1)
+		if v != first {
+			t.Fatalf("disagreement on slot 1: %s vs %s", v, first)
+		}
+		if _, ok := chain.ExternalizedValue(2); ok {
+			t.Fatal("slot 2 should not be externalized yet")
+		}
+	}
+}
+
+func TestChainDropsOutOfWindowMessages(t *testing.T) {
+	chains := chainCluster(4)
+	for i := 0; i < 10 && progress(chains) < 1; i++ {
+		for _, source := range chains {
+			for _, target := range chains {
+				chainSend(source, target)
+			}
+		}
+	}
+	chain := chains[0]
+	sender := chains[1].publicKey.String()
+	if chain.Slot() != 2 {
+		t.Fatalf("expected to advance to slot 2 but got %d", chain.Slot())
+	}
+
+	// Slot zero is never valid
+	zero := &NominationMessage{I: 0, D: chain.D}
+	if chain.Handle(sender, zero) != nil {
+		t.Fatal("a message for slot zero should be dropped")
+	}
+
+	// Too far in the future
+	future := &NominationMessage{I: 3 + chain.SlotWindow, D: chain.D}
+	if chain.Handle(sender, future) != nil {
+		t.Fatal("a message too far in the future should be dropped")
+	}
+	if chain.Slot() != 2 {
+		t.Fatal("a dropped message should not change the slot")
+	}
+
+	// A stale slot is never handed to a block, but the sender gets a catchup
+	stale := &NominationMessage{I: 1, D: chain.D}
+	response := chain.Handle(sender, stale)
+	if _, ok := response.(*ExternalizeMessage); !ok {
+		t.Fatalf("expected a catchup for a stale slot but got %+v", response)
+	}
+	if chain.Slot() != 2 {
+		t.Fatal("a stale message should not change the slot")
+	}
+}
+
+func TestChainDropsBadQuorumSlices(t *testing.T) {
+	qs, names := MakeTestQuorumSlice(4)
+	chain := NewEmptyChain(names[0], qs, NewTestValueStore(0))
+	sender := names[1].String()
+
+	huge := QuorumSlice{Threshold: 1}
+	for i := 0; i <= chain.MaxQuorumMembers; i++ {
+		huge.Members = append(huge.Members, fmt.Sprintf("node%d", i))
+	}
+	bad := []QuorumSlice{
+		huge,
+		QuorumSlice{Members: qs.Members, Threshold: 0},
+		QuorumSlice{Members: qs.Members, Threshold: 5},
+		QuorumSlice{Members: []string{"a", "a"}, Threshold: 1},
+	}
+	for _, d := range bad {
+		m := &NominationMessage{I: 1, Nom: []SlotValue{"bad"}, D: d}
+		chain.Handle(sender, m)
+		if _, ok := chain.current.nState.N[sender]; ok {
+			t.Fatalf("a message with a bad quorum slice was handled: %+v", d)
+		}
+	}
+
+	m := &NominationMessage{I: 1, Nom: []SlotValue{"good"}, D: qs}
+	chain.Handle(sender, m)
+	if _, ok := chain.current.nState.N[sender]; !ok {
+		t.Fatal("a message with a valid quorum slice should be handled")
+	}
+}
+
+func TestChainIgnoresStrangers(t *testing.T) {
+	qs, names := MakeTestQuorumSlice(4)
+	chain := NewEmptyChain(names[0], qs, NewTestValueStore(0))
+	v := SlotValue("value")
+	chain.current.nState.NominateNewValue(v)
+
+	// A stranger whose quorum slice includes everyone
+	stranger := util.NewKeyPairFromSecretPhrase("stranger").PublicKey().String()
+	members := append([]string{stranger}, qs.Members...)
+	strangerSlice, err := MakeQuorumSlice(members, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Handle(stranger, &NominationMessage{I: 1, Nom: []SlotValue{v}, D: strangerSlice})
+	chain.Handle(names[1].String(), &NominationMessage{I: 1, Nom: []SlotValue{v}, D: qs})
+
+	// With the stranger we would have three votes, which would be a quorum
+	nState := chain.current.nState
+	if _, ok := nState.N[stranger]; ok {
+		t.Fatal("the stranger's message should not be stored")
+	}
+	if HasSlotValue(nState.Y, v) {
+		t.Fatal("the stranger's vote should not count toward a quorum")
+	}
+
+	// Once a member lists the stranger in its quorum slice, the stranger is
+	// no longer unknown
+	chain.Handle(names[2].String(), &NominationMessage{I: 1, D: strangerSlice})
+	chain.Handle(stranger, &NominationMessage{I: 1, Nom: []SlotValue{v}, D: strangerSlice})
+	if _, ok := nState.N[stranger]; !ok {
+		t.Fatal("a node in a member's quorum slice should be listened to")
+	}
+
+	// The stranger can't vouch for its own strangers
+	other := util.NewKeyPairFromSecretPhrase("other stranger").PublicKey().String()
+	otherSlice, err := MakeQuorumSlice(append([]string{other}, members...), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Handle(stranger, &NominationMessage{I: 1, Nom: []SlotValue{v}, D: otherSlice})
+	chain.Handle(other, &NominationMessage{I: 1, Nom: []SlotValue{v}, D: otherSlice})
+	if _, ok := nState.N[other]; ok {
+		t.Fatal("a stranger's stranger should not be listened to")
+	}
+
+	// Once the member drops the stranger, the stranger is unknown again
+	chain.Handle(names[2].String(), &NominationMessage{I: 1, D: qs})
+	if chain.isKnown(stranger) {
+		t.Fatal("a node dropped from every member's slice should be unknown")
+	}
+}
+
+func TestChainStuck(t *testing.T) {
+	chains := chainCluster(4)
+	chain := chains[0]
+	for i := 0; i < 5; i++ {
+		chain.Tick()
+		if chain.Stuck(6) {
+			t.Fatalf("should not be stuck after %d ticks", i+1)
+		}
+	}
+	chain.Tick()
+	if !chain.Stuck(6) {
+		t.Fatal("a chain with no incoming messages should get stuck")
+	}
+
+	// Progress unsticks it
+	for i := 0; i < 10 && progress(chains) < 1; i++ {
+		for _, source := range chains {
+			for _, target := range chains {
+				chainSend(source, target)
+			}
+		}
+	}
+	chain.Tick()
+	if chain.Stuck(1) {
+		t.Fatal("a chain that advanced should not be stuck")
+	}
+}
+
+func TestChainOutgoingMessagesAdvertiseProgress(t *testing.T) {
+	chains := chainCluster(4)
+	for i := 0; i < 10 && progress(chains) < 1; i++ {
+		for _, source := range chains {
+			for _, target := range chains {
+				chainSend(source, target)
+			}
+		}
+	}
+	chain := chains[0]
+	externalized := 0
+	for _, m := range chain.OutgoingMessages() {
+		if e, ok := m.(*ExternalizeMessage); ok {
+			if e.Slot() != 1 {
+				t.Fatalf("expected an externalize for slot 1, got %s", e)
+			}
+			externalized++
+			continue
+		}
+		if m.Slot() != chain.Slot() {
+			t.Fatalf("expected slot %d but got %s", chain.Slot(), m)
+		}
+	}
+	if externalized != 1 {
+		t.Fatal("the highest externalized slot should be advertised")
+	}
+}
+
+func TestChainCallbacks(t *testing.T) {
+	chains := chainCluster(4)
+	type transition struct {
+		slot     int
+		old, new Phase
+	}
+	transitions := []transition{}
+	externalized := []int{}
+	chain := chains[0]
+	chain.OnPhaseChange = func(slot int, old, new Phase) {
+		transitions = append(transitions, transition{slot, old, new})
+	}
+	chain.OnExternalize = func(slot int, v SlotValue) {
+		x, ok := chain.ExternalizedValue(slot)
+		if !ok {
+			t.Fatalf("slot %d should be in the history during the callback", slot)
+		}
+		if x != v {
+			t.Fatalf("slot %d externalized %s but the callback got %s", slot, x, v)
+		}
+		externalized = append(externalized, slot)
+	}
+
+	for i := 0; i < 20 && progress(chains) < 3; i++ {
+		for _, source := range chains {
+			for _, target := range chains {
+				chainSend(source, target)
+			}
+		}
+	}
+	if progress(chains) < 3 {
+		t.Fatal("the cluster should externalize three slots")
+	}
+
+	finished := chain.Slot() - 1
+	if len(externalized) != finished {
+		t.Fatalf("expected %d externalize callbacks, got %v", finished, externalized)
+	}
+	for i, slot := range externalized {
+		if slot != i+1 {
+			t.Fatalf("unexpected externalize order: %v", externalized)
+		}
+	}
+
+	// Each finished slot went through each phase once
+	seen := make(map[transition]int)
+	for _, tr := range transitions {
+		if tr.old == tr.new {
+			t.Fatalf("a callback reported no change: %+v", tr)
+		}
+		seen[tr]++
+	}
+	for slot := 1; slot <= finished; slot++ {
+		if seen[transition{slot, Prepare, Confirm}] != 1 {
+			t.Fatalf("slot %d did not go from prepare to confirm once: %+v",
+				slot, transitions)
+		}
+		if seen[transition{slot, Confirm, Externalize}] != 1 {
+			t.Fatalf("slot %d did not go from confirm to externalize once: %+v",
+				slot, transitions)
+		}
+	}
+}
+
+func TestChainTracksQuorums(t *testing.T) {
+	chains := chainCluster(4)
+	for _, source := range chains {
+		for _, target := range chains {
+			chainSend(source, target)
+		}
+	}
+	for _, chain := range chains {
+		if len(chain.Quorums().NodesList()) != 4 {
+			t.Fatalf("expected 4 nodes but got %v", chain.Quorums().NodesList())
+		}
+		if ok, err := chain.Quorums().QuorumsIntersect(); !ok || err != nil {
+			t.Fatal("the test cluster's quorums should intersect")
+		}
+	}
+}
+
+func TestChainKeepsNewestQuorumSlice(t *testing.T) {
+	qs, names := MakeTestQuorumSlice(4)
+	chain := NewEmptyChain(names[0], qs, NewTestValueStore(0))
+	chain.current = NewBlock(chain.publicKey, qs, 3, chain.values)
+	sender := names[1].String()
+
+	smaller, err := MakeQuorumSlice(qs.Members[:3], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Handle(sender, &NominationMessage{I: 3, D: smaller})
+	chain.Handle(sender, &NominationMessage{I: 2, D: qs})
+	got, ok := chain.Quorums().Get(sender)
+	if !ok || !reflect.DeepEqual(got, smaller) {
+		t.Fatalf("an old-slot message replaced the newer slice: %+v", got)
+	}
+}
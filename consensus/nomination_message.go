@@ -31,6 +31,10 @@ func (m *NominationMessage) Slot() int {
 	return m.I
 }
 
+func (m *NominationMessage) QuorumSlice() QuorumSlice {
+	return m.D
+}
+
 func (m *NominationMessage) String() string {
 	shortNom := []string{}
 	shortAcc := []string{}
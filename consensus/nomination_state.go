@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"sort"
+
 	"coinkit/util"
 )
 
@@ -102,6 +104,20 @@ func (s *NominationState) WantsToNominateNewValue() bool {
 	return s.D.Threshold*s.priority <= s.received
 }
 
+// ShouldNominate returns whether me should be nominating in the given round.
+// In round r, only the nodes whose seed priority is at most r nominate, so
+// the highest-priority node starts alone and others join in as rounds pass.
+// A node that isn't in nodes never nominates.
+func (s *NominationState) ShouldNominate(
+	seed string, nodes []string, me string, round int) bool {
+	for _, node := range nodes {
+		if node == me {
+			return SeedPriority(seed, nodes, me) <= round
+		}
+	}
+	return false
+}
+
 func (s *NominationState) NominateNewValue(v SlotValue) {
 	if s.HasNomination() {
 		// We already have something to nominate
@@ -110,6 +126,16 @@ func (s *NominationState) NominateNewValue(v SlotValue) {
 	s.X = []SlotValue{v}
 }
 
+// CandidateValue combines every confirmed nomination into the single value
+// that balloting should start with. It returns false if no nomination has
+// been confirmed yet.
+func (s *NominationState) CandidateValue() (SlotValue, bool) {
+	if len(s.Z) == 0 {
+		return SlotValue(""), false
+	}
+	return s.values.Combine(s.Z), true
+}
+
 // PredictValue can predict the value iff HasNomination is true. If not, panic
 func (s *NominationState) PredictValue() SlotValue {
 	if len(s.Z) > 0 {
@@ -145,6 +171,47 @@ func (s *NominationState) AssertValid() {
 	AssertNoDupes(s.Z)
 }
 
+// AcceptedBy returns the nodes that have either voted for or accepted the
+// nomination of v, including ourselves. The result is sorted.
+func (s *NominationState) AcceptedBy(v SlotValue) []string {
+	nodes := []string{}
+	if HasSlotValue(s.X, v) || HasSlotValue(s.Y, v) {
+		nodes = append(nodes, s.publicKey.String())
+	}
+	for node, m := range s.N {
+		if HasSlotValue(m.Acc, v) || HasSlotValue(m.Nom, v) {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// acceptedOnlyBy returns the nodes that have accepted the nomination of v,
+// including ourselves. The result is sorted.
+func (s *NominationState) acceptedOnlyBy(v SlotValue) []string {
+	nodes := []string{}
+	if HasSlotValue(s.Y, v) {
+		nodes = append(nodes, s.publicKey.String())
+	}
+	for node, m := range s.N {
+		if HasSlotValue(m.Acc, v) {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// CanAccept returns whether we should accept the nomination of v.
+// The rules for accepting are on page 13, section 5.3
+// Rule 1: if a quorum has either voted for the nomination or accepted the
+// nomination, we accept it.
+// Rule 2: if a blocking set for us accepts the nomination, we accept it.
+func (s *NominationState) CanAccept(v SlotValue) bool {
+	return MeetsQuorum(s, s.AcceptedBy(v)) || s.D.BlockedBy(s.acceptedOnlyBy(v))
+}
+
 // MaybeAdvance checks whether we should accept the nomination for this slot value,
 // and adds it to our accepted list if appropriate.
 // It also checks whether we should confirm the nomination.
@@ -156,30 +223,8 @@ func (s *NominationState) MaybeAdvance(v SlotValue) bool {
 	}
 
 	changed := false
-	votedOrAccepted := []string{}
-	accepted := []string{}
-	if HasSlotValue(s.X, v) {
-		votedOrAccepted = append(votedOrAccepted, s.publicKey.String())
-	}
-	if HasSlotValue(s.Y, v) {
-		accepted = append(accepted, s.publicKey.String())
-	}
-	for node, m := range s.N {
-		if HasSlotValue(m.Acc, v) {
-			votedOrAccepted = append(votedOrAccepted, node)
-			accepted = append(accepted, node)
-			continue
-		}
-		if HasSlotValue(m.Nom, v) {
-			votedOrAccepted = append(votedOrAccepted, node)
-		}
-	}
-
-	// The rules for accepting are on page 13, section 5.3
-	// Rule 1: if a quorum has either voted for the nomination or accepted the
-	// nomination, we accept it.
-	// Rule 2: if a blocking set for us accepts the nomination, we accept it.
-	accept := MeetsQuorum(s, votedOrAccepted) || s.D.BlockedBy(accepted)
+	accepted := s.acceptedOnlyBy(v)
+	accept := s.CanAccept(v)
 
 	if accept && !HasSlotValue(s.Y, v) {
 		// Accept this value
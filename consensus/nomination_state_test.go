@@ -0,0 +1,78 @@
+package consensus
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNominationAcceptedBy(t *testing.T) {
+	qs, pks := MakeTestQuorumSlice(4)
+	s := NewNominationState(pks[0], qs, NewTestValueStore(0))
+	v := SlotValue("value")
+	w := SlotValue("other")
+
+	// node1 votes for v, node2 accepts v, node3 votes for w
+	s.N[pks[1].String()] = &NominationMessage{I: 1, Nom: []SlotValue{v}, D: qs}
+	s.N[pks[2].String()] = &NominationMessage{
+		I: 1, Nom: []SlotValue{v}, Acc: []SlotValue{v}, D: qs}
+	s.N[pks[3].String()] = &NominationMessage{I: 1, Nom: []SlotValue{w}, D: qs}
+
+	expected := []string{pks[1].String(), pks[2].String()}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(s.AcceptedBy(v), expected) {
+		t.Fatalf("bad AcceptedBy: %v", s.AcceptedBy(v))
+	}
+	if s.CanAccept(v) {
+		t.Fatal("two of four nodes should not be enough to accept")
+	}
+
+	// Once we vote for v too, exactly a quorum has voted for it
+	s.X = []SlotValue{v}
+	if len(s.AcceptedBy(v)) != 3 {
+		t.Fatalf("bad AcceptedBy: %v", s.AcceptedBy(v))
+	}
+	if !s.CanAccept(v) {
+		t.Fatal("a quorum voting for v should be enough to accept")
+	}
+	if s.CanAccept(w) {
+		t.Fatal("one node voting for w should not be enough to accept")
+	}
+}
+
+func TestNominationCandidateValue(t *testing.T) {
+	qs, pks := MakeTestQuorumSlice(4)
+	s := NewNominationState(pks[0], qs, NewTestValueStore(0))
+	if _, ok := s.CandidateValue(); ok {
+		t.Fatal("there should be no candidate value before confirming anything")
+	}
+	s.Z = []SlotValue{"c", "a", "b"}
+	v, ok := s.CandidateValue()
+	if !ok {
+		t.Fatal("there should be a candidate value")
+	}
+	if v != SlotValue("a,b,c") {
+		t.Fatalf("bad candidate value: %s", v)
+	}
+}
+
+func TestShouldNominate(t *testing.T) {
+	qs, pks := MakeTestQuorumSlice(4)
+	s := NewNominationState(pks[0], qs, NewTestValueStore(0))
+	seed := "seed"
+	leader, err := SeedLeader(seed, qs.Members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range qs.Members {
+		if s.ShouldNominate(seed, qs.Members, node, 0) != (node == leader) {
+			t.Fatalf("only the leader should nominate in round 0, not %s", node)
+		}
+		if !s.ShouldNominate(seed, qs.Members, node, len(qs.Members)-1) {
+			t.Fatalf("%s should nominate by the last round", node)
+		}
+	}
+	if s.ShouldNominate(seed, qs.Members, "stranger", 10) {
+		t.Fatal("a node outside the list should never nominate")
+	}
+}
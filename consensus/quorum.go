@@ -1,7 +1,9 @@
 package consensus
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 
 	"coinkit/util"
 )
@@ -13,24 +15,132 @@ type QuorumSlice struct {
 	Members []string
 
 	// The number of members we require for consensus, including ourselves.
-	// The protocol can support other sorts of slices, like weighted or any wacky
-	// thing, but for now we only do this simple "any k out of these n" voting.
+	// This is simple "any k out of these n" voting. For anything fancier,
+	// use Weights.
 	Threshold int
+
+	// Weights optionally gives each member a voting weight. When Weights is
+	// nil, every member counts once and Threshold is used.
+	// When it is set, members missing from Weights have no weight, and
+	// WeightThreshold is used instead of Threshold.
+	Weights map[string]int
+
+	// The total weight we require for consensus, when Weights is set.
+	WeightThreshold int
+
+	// Inner optionally lists nested quorum slices. Each inner slice counts as
+	// one unit, with a weight of one, toward this slice's threshold when it
+	// is satisfied. This is how hierarchical quorums like "2 of these 3
+	// organizations" are expressed.
+	Inner []QuorumSlice
 }
 
-func MakeQuorumSlice(members []string, threshold int) QuorumSlice {
+// DefaultMaxQuorumMembers is how many members, counting those of inner slices,
+// we accept in a quorum slice from a peer by default.
+const DefaultMaxQuorumMembers = 100
+
+// MakeQuorumSlice returns an error if the quorum slice would be unusable.
+// The threshold must be in [1, len(members)] and members must be unique.
+func MakeQuorumSlice(members []string, threshold int) (QuorumSlice, error) {
+	var invalid QuorumSlice
+	if threshold < 1 {
+		return invalid, errors.New("quorum threshold must be at least 1")
+	}
+	if threshold > len(members) {
+		return invalid, fmt.Errorf("quorum threshold %d exceeds %d members",
+			threshold, len(members))
+	}
+	seen := make(map[string]bool)
+	for _, member := range members {
+		if seen[member] {
+			return invalid, fmt.Errorf("duplicate quorum member: %s", member)
+		}
+		seen[member] = true
+	}
 	return QuorumSlice{
 		Members:   members,
 		Threshold: threshold,
+	}, nil
+}
+
+// countMembers returns the number of members, including those of inner
+// slices. Members of different inner slices may be counted more than once.
+func (qs *QuorumSlice) countMembers() int {
+	count := len(qs.Members)
+	for i := range qs.Inner {
+		count += qs.Inner[i].countMembers()
+	}
+	return count
+}
+
+// Validate returns an error if this quorum slice has more than maxMembers
+// members in total, duplicate members, negative weights, or a threshold that
+// could never be met. It is meant for quorum slices that come from peers.
+func (qs *QuorumSlice) Validate(maxMembers int) error {
+	if count := qs.countMembers(); count > maxMembers {
+		return fmt.Errorf("quorum slice has %d members but the max is %d",
+			count, maxMembers)
+	}
+	return qs.validate()
+}
+
+func (qs *QuorumSlice) validate() error {
+	seen := make(map[string]bool)
+	for _, member := range qs.Members {
+		if seen[member] {
+			return fmt.Errorf("duplicate quorum member: %s", member)
+		}
+		seen[member] = true
+		if qs.weight(member) < 0 {
+			return fmt.Errorf("negative weight for quorum member: %s", member)
+		}
+	}
+	if qs.threshold() < 1 {
+		return errors.New("quorum threshold must be at least 1")
+	}
+	if qs.threshold() > qs.totalWeight() {
+		return fmt.Errorf("quorum threshold %d exceeds total weight %d",
+			qs.threshold(), qs.totalWeight())
+	}
+	for i := range qs.Inner {
+		if err := qs.Inner[i].validate(); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (qs *QuorumSlice) atLeast(nodes []string, t int) bool {
+func (qs *QuorumSlice) weight(member string) int {
+	if qs.Weights == nil {
+		return 1
+	}
+	return qs.Weights[member]
+}
+
+func (qs *QuorumSlice) totalWeight() int {
+	total := len(qs.Inner)
+	for _, member := range qs.Members {
+		total += qs.weight(member)
+	}
+	return total
+}
+
+func (qs *QuorumSlice) threshold() int {
+	if qs.Weights == nil {
+		return qs.Threshold
+	}
+	return qs.WeightThreshold
+}
+
+// atLeast checks whether the members present in nodes, plus the inner
+// slices that pass the check function, have a total weight of at least t.
+func (qs *QuorumSlice) atLeast(
+	nodes []string, t int, check func(inner *QuorumSlice) bool) bool {
 	count := 0
 	for _, member := range qs.Members {
 		for _, node := range nodes {
 			if node == member {
-				count++
+				count += qs.weight(member)
 				if count >= t {
 					return true
 				}
@@ -38,15 +148,92 @@ func (qs *QuorumSlice) atLeast(nodes []string, t int) bool {
 			}
 		}
 	}
+	for i := range qs.Inner {
+		if check(&qs.Inner[i]) {
+			count++
+			if count >= t {
+				return true
+			}
+		}
+	}
 	return false
 }
 
+// BlockedBy returns whether nodes intersects every possible quorum slice
+// made from this one. That happens when more than len(Members) - Threshold
+// of the members are present, or the equivalent by weight.
+// An inner slice counts as present when nodes is blocking for it.
 func (qs *QuorumSlice) BlockedBy(nodes []string) bool {
-	return qs.atLeast(nodes, len(qs.Members)-qs.Threshold+1)
+	return qs.atLeast(nodes, qs.totalWeight()-qs.threshold()+1,
+		func(inner *QuorumSlice) bool {
+			return inner.BlockedBy(nodes)
+		})
 }
 
+// SatisfiedWith returns whether at least Threshold of the members are
+// present in nodes, or at least WeightThreshold of their weight.
+// An inner slice counts as present when nodes satisfies it.
 func (qs *QuorumSlice) SatisfiedWith(nodes []string) bool {
-	return qs.atLeast(nodes, qs.Threshold)
+	return qs.atLeast(nodes, qs.threshold(),
+		func(inner *QuorumSlice) bool {
+			return inner.SatisfiedWith(nodes)
+		})
+}
+
+// AllMembers returns a sorted list of every node mentioned in this quorum
+// slice, including the members of inner slices, without duplicates.
+func (qs *QuorumSlice) AllMembers() []string {
+	seen := make(map[string]bool)
+	qs.addMembers(seen)
+	answer := []string{}
+	for member, _ := range seen {
+		answer = append(answer, member)
+	}
+	sort.Strings(answer)
+	return answer
+}
+
+func (qs *QuorumSlice) addMembers(seen map[string]bool) {
+	for _, member := range qs.Members {
+		seen[member] = true
+	}
+	for i := range qs.Inner {
+		qs.Inner[i].addMembers(seen)
+	}
+}
+
+// Union returns a slice that is satisfied exactly when both qs and other are.
+// The two slices become its inner slices, so weights and nesting are kept,
+// and its members are every node mentioned in either.
+func (qs *QuorumSlice) Union(other QuorumSlice) QuorumSlice {
+	return QuorumSlice{
+		Members:   []string{},
+		Threshold: 2,
+		Inner:     []QuorumSlice{*qs, other},
+	}
+}
+
+// QuorumSliceDiff describes how membership changes going from a to b.
+// added is the nodes in b that are not in a, removed is the nodes in a that
+// are not in b. Both are sorted.
+func QuorumSliceDiff(a, b QuorumSlice) (added, removed []string) {
+	before := make(map[string]bool)
+	a.addMembers(before)
+	after := make(map[string]bool)
+	b.addMembers(after)
+	added = []string{}
+	removed = []string{}
+	for _, member := range b.AllMembers() {
+		if !before[member] {
+			added = append(added, member)
+		}
+	}
+	for _, member := range a.AllMembers() {
+		if !after[member] {
+			removed = append(removed, member)
+		}
+	}
+	return added, removed
 }
 
 // Makes data for a test quorum slice that requires a consensus of more
@@ -61,7 +248,10 @@ func MakeTestQuorumSlice(size int) (QuorumSlice, []util.PublicKey) {
 		pks = append(pks, pk)
 		names = append(names, pk.String())
 	}
-	qs := MakeQuorumSlice(names, threshold)
+	qs, err := MakeQuorumSlice(names, threshold)
+	if err != nil {
+		panic(err)
+	}
 	return qs, pks
 }
 
@@ -93,3 +283,113 @@ func MeetsQuorum(f QuorumFinder, nodes []string) bool {
 	}
 	return MeetsQuorum(f, filtered)
 }
+
+// largestQuorum returns the largest quorum contained in nodes, given the
+// quorum slice of every node. It is empty if there is no such quorum.
+func largestQuorum(slices map[string]QuorumSlice, nodes []string) []string {
+	for {
+		filtered := []string{}
+		for _, node := range nodes {
+			qs, ok := slices[node]
+			if ok && qs.SatisfiedWith(nodes) {
+				filtered = append(filtered, node)
+			}
+		}
+		if len(filtered) == len(nodes) {
+			return nodes
+		}
+		nodes = filtered
+	}
+}
+
+// A QuorumMap keeps the latest quorum slice each node has advertised.
+// It is the consensus layer's view of the network topology.
+type QuorumMap struct {
+	slices map[string]QuorumSlice
+
+	// The slot of the message each slice came from
+	slots map[string]int
+}
+
+func NewQuorumMap() *QuorumMap {
+	return &QuorumMap{
+		slices: make(map[string]QuorumSlice),
+		slots:  make(map[string]int),
+	}
+}
+
+// Update records qs as the quorum slice node advertised for slot.
+// It replaces the slice we have for node unless that came from a later slot,
+// so a delayed message can't roll a node's slice back.
+// Returns whether qs was recorded.
+func (qm *QuorumMap) Update(node string, slot int, qs QuorumSlice) bool {
+	if old, ok := qm.slots[node]; ok && slot < old {
+		return false
+	}
+	qm.slices[node] = qs
+	qm.slots[node] = slot
+	return true
+}
+
+// Get returns the latest quorum slice for node.
+// The bool is false if node has not advertised one.
+func (qm *QuorumMap) Get(node string) (QuorumSlice, bool) {
+	qs, ok := qm.slices[node]
+	return qs, ok
+}
+
+// NodesList returns the nodes that have advertised a quorum slice, sorted.
+func (qm *QuorumMap) NodesList() []string {
+	nodes := []string{}
+	for node, _ := range qm.slices {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// MaxIntersectionNodes is the most nodes QuorumsIntersect will check.
+// The check looks at all 2^n subsets of nodes, doing O(n^2) work for each,
+// so much past 20 nodes it would never finish.
+const MaxIntersectionNodes = 20
+
+// QuorumsIntersect returns whether every two quorums of this network share
+// at least one node, given the quorum slice of every node. If they don't,
+// the network can split into parts that externalize different values.
+// This checks every subset of nodes, so it returns an error for networks of
+// more than MaxIntersectionNodes nodes.
+func QuorumsIntersect(slices map[string]QuorumSlice) (bool, error) {
+	return (&QuorumMap{slices: slices}).QuorumsIntersect()
+}
+
+// QuorumsIntersect is like the QuorumsIntersect function, using the latest
+// slice for each node in qm.
+func (qm *QuorumMap) QuorumsIntersect() (bool, error) {
+	nodes := qm.NodesList()
+	if len(nodes) > MaxIntersectionNodes {
+		return false, fmt.Errorf(
+			"cannot check quorum intersection for %d nodes, the max is %d",
+			len(nodes), MaxIntersectionNodes)
+	}
+
+	for mask := 1; mask < 1<<uint(len(nodes)); mask++ {
+		subset := []string{}
+		rest := []string{}
+		for i, node := range nodes {
+			if mask&(1<<uint(i)) != 0 {
+				subset = append(subset, node)
+			} else {
+				rest = append(rest, node)
+			}
+		}
+		if len(largestQuorum(qm.slices, subset)) != len(subset) {
+			// subset isn't a quorum
+			continue
+		}
+		if len(largestQuorum(qm.slices, rest)) > 0 {
+			// There's a quorum disjoint from subset
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,330 @@
+package consensus
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestQuorumSliceThresholds(t *testing.T) {
+	members := []string{"a", "b", "c", "d"}
+	cases := []struct {
+		threshold int
+		nodes     []string
+		satisfied bool
+		blocked   bool
+	}{
+		{1, []string{}, false, false},
+		{1, []string{"a"}, true, false},
+		{1, []string{"a", "b", "c"}, true, false},
+		{1, []string{"a", "b", "c", "d"}, true, true},
+		{3, []string{"a"}, false, false},
+		{3, []string{"a", "b"}, false, true},
+		{3, []string{"a", "b", "c"}, true, true},
+		{3, []string{"a", "b", "x", "y"}, false, true},
+		{4, []string{"a"}, false, true},
+		{4, []string{"a", "b", "c"}, false, true},
+		{4, []string{"a", "b", "c", "d"}, true, true},
+		{4, []string{"a", "a", "a", "a"}, false, true},
+		{4, []string{"x", "y", "z", "w"}, false, false},
+	}
+	for _, c := range cases {
+		qs := QuorumSlice{Members: members, Threshold: c.threshold}
+		if qs.SatisfiedWith(c.nodes) != c.satisfied {
+			t.Fatalf("threshold %d with %v: expected satisfied = %v",
+				c.threshold, c.nodes, c.satisfied)
+		}
+		if qs.BlockedBy(c.nodes) != c.blocked {
+			t.Fatalf("threshold %d with %v: expected blocked = %v",
+				c.threshold, c.nodes, c.blocked)
+		}
+	}
+}
+
+func TestMakeQuorumSlice(t *testing.T) {
+	if _, err := MakeQuorumSlice([]string{"a", "b", "c"}, 2); err != nil {
+		t.Fatalf("a valid quorum slice was rejected: %s", err)
+	}
+	if _, err := MakeQuorumSlice([]string{"a", "b", "a"}, 2); err == nil {
+		t.Fatal("duplicate members should be rejected")
+	}
+	if _, err := MakeQuorumSlice([]string{"a", "b", "c"}, 0); err == nil {
+		t.Fatal("a zero threshold should be rejected")
+	}
+	if _, err := MakeQuorumSlice([]string{"a", "b", "c"}, 4); err == nil {
+		t.Fatal("a threshold exceeding membership should be rejected")
+	}
+}
+
+func TestWeightedQuorumSlice(t *testing.T) {
+	qs := QuorumSlice{
+		Members:         []string{"heavy", "a", "b", "c"},
+		Threshold:       4,
+		Weights:         map[string]int{"heavy": 5, "a": 1, "b": 1, "c": 1},
+		WeightThreshold: 5,
+	}
+	if !qs.SatisfiedWith([]string{"heavy"}) {
+		t.Fatal("the heavy node alone should cross the weight threshold")
+	}
+	if qs.SatisfiedWith([]string{"a", "b", "c"}) {
+		t.Fatal("the light nodes together should not be enough")
+	}
+	if !qs.BlockedBy([]string{"heavy"}) {
+		t.Fatal("the heavy node alone should be blocking")
+	}
+	if qs.BlockedBy([]string{"a", "b", "c"}) {
+		t.Fatal("the light nodes should not block the heavy node alone")
+	}
+
+	// Without weights, the plain threshold applies
+	qs.Weights = nil
+	if qs.SatisfiedWith([]string{"heavy"}) {
+		t.Fatal("unweighted, one node should not meet a threshold of 4")
+	}
+	if !qs.SatisfiedWith([]string{"heavy", "a", "b", "c"}) {
+		t.Fatal("unweighted, all four nodes should meet a threshold of 4")
+	}
+}
+
+func TestNestedQuorumSlice(t *testing.T) {
+	// 3 of {orgA needs 2-of-3, orgB needs 2-of-3, orgC}
+	qs := QuorumSlice{
+		Members:   []string{"c"},
+		Threshold: 3,
+		Inner: []QuorumSlice{
+			QuorumSlice{Members: []string{"a1", "a2", "a3"}, Threshold: 2},
+			QuorumSlice{Members: []string{"b1", "b2", "b3"}, Threshold: 2},
+		},
+	}
+	if !qs.SatisfiedWith([]string{"a1", "a3", "b2", "b3", "c"}) {
+		t.Fatal("two of each org plus c should be satisfying")
+	}
+	if qs.SatisfiedWith([]string{"a1", "a2", "a3", "b1", "c"}) {
+		t.Fatal("orgB is not satisfied with only one member")
+	}
+	if qs.SatisfiedWith([]string{"a1", "a2", "b1", "b2"}) {
+		t.Fatal("c is required")
+	}
+	if !qs.BlockedBy([]string{"c"}) {
+		t.Fatal("c alone should be blocking")
+	}
+	if !qs.BlockedBy([]string{"b1", "b3"}) {
+		t.Fatal("two of orgB should be blocking")
+	}
+	if qs.BlockedBy([]string{"a1", "b1"}) {
+		t.Fatal("one member per org should not be blocking")
+	}
+}
+
+func TestQuorumSliceUnionAndDiff(t *testing.T) {
+	cases := []struct {
+		a, b           QuorumSlice
+		union          []string
+		added, removed []string
+	}{
+		// Overlapping
+		{
+			QuorumSlice{Members: []string{"c", "a", "b"}, Threshold: 2},
+			QuorumSlice{Members: []string{"b", "c", "d"}, Threshold: 3},
+			[]string{"a", "b", "c", "d"},
+			[]string{"d"},
+			[]string{"a"},
+		},
+		// Disjoint
+		{
+			QuorumSlice{Members: []string{"a", "b"}, Threshold: 2},
+			QuorumSlice{Members: []string{"x", "y"}, Threshold: 1},
+			[]string{"a", "b", "x", "y"},
+			[]string{"x", "y"},
+			[]string{"a", "b"},
+		},
+		// Identical, with nesting
+		{
+			QuorumSlice{
+				Members:   []string{"a"},
+				Threshold: 1,
+				Inner:     []QuorumSlice{{Members: []string{"b", "a"}, Threshold: 1}},
+			},
+			QuorumSlice{Members: []string{"b", "a"}, Threshold: 1},
+			[]string{"a", "b"},
+			[]string{},
+			[]string{},
+		},
+	}
+	for i, c := range cases {
+		union := c.a.Union(c.b)
+		if !reflect.DeepEqual(union.AllMembers(), c.union) {
+			t.Fatalf("case %d: bad union: %v", i, union.AllMembers())
+		}
+		if err := union.Validate(DefaultMaxQuorumMembers); err != nil {
+			t.Fatalf("case %d: invalid union: %s", i, err)
+		}
+		if !union.SatisfiedWith(c.union) {
+			t.Fatalf("case %d: everyone should satisfy the union", i)
+		}
+		added, removed := QuorumSliceDiff(c.a, c.b)
+		if !reflect.DeepEqual(added, c.added) {
+			t.Fatalf("case %d: bad added: %v", i, added)
+		}
+		if !reflect.DeepEqual(removed, c.removed) {
+			t.Fatalf("case %d: bad removed: %v", i, removed)
+		}
+	}
+}
+
+func TestQuorumSliceUnionNeedsBoth(t *testing.T) {
+	a := QuorumSlice{Members: []string{"a", "b"}, Threshold: 2}
+	b := QuorumSlice{Members: []string{"x", "y"}, Threshold: 1}
+	union := a.Union(b)
+	if union.SatisfiedWith([]string{"x", "y"}) {
+		t.Fatal("satisfying only b should not satisfy the union")
+	}
+	if union.SatisfiedWith([]string{"a", "b"}) {
+		t.Fatal("satisfying only a should not satisfy the union")
+	}
+	if !union.SatisfiedWith([]string{"a", "b", "x"}) {
+		t.Fatal("satisfying both should satisfy the union")
+	}
+
+	// Weights are kept
+	weighted := QuorumSlice{
+		Members:         []string{"a", "x"},
+		Weights:         map[string]int{"a": 3, "x": 1},
+		WeightThreshold: 3,
+	}
+	union = weighted.Union(b)
+	if union.SatisfiedWith([]string{"x", "y"}) {
+		t.Fatal("x alone does not have enough weight")
+	}
+	if !union.SatisfiedWith([]string{"a", "y"}) {
+		t.Fatal("a has enough weight, and y satisfies b")
+	}
+}
+
+func TestQuorumsIntersect(t *testing.T) {
+	// Three of four nodes, everyone agreeing
+	good := make(map[string]QuorumSlice)
+	members := []string{"a", "b", "c", "d"}
+	for _, member := range members {
+		good[member] = QuorumSlice{Members: members, Threshold: 3}
+	}
+	if ok, err := QuorumsIntersect(good); !ok || err != nil {
+		t.Fatal("3 of 4 quorums should intersect")
+	}
+
+	// Two of four nodes can split into {a, b} and {c, d}
+	half := make(map[string]QuorumSlice)
+	for _, member := range members {
+		half[member] = QuorumSlice{Members: members, Threshold: 2}
+	}
+	if ok, _ := QuorumsIntersect(half); ok {
+		t.Fatal("2 of 4 quorums should not intersect")
+	}
+
+	// Two groups that only trust themselves
+	split := map[string]QuorumSlice{
+		"a": QuorumSlice{Members: []string{"a", "b"}, Threshold: 2},
+		"b": QuorumSlice{Members: []string{"a", "b"}, Threshold: 2},
+		"c": QuorumSlice{Members: []string{"c", "d", "a"}, Threshold: 2},
+		"d": QuorumSlice{Members: []string{"c", "d", "a"}, Threshold: 2},
+	}
+	if ok, _ := QuorumsIntersect(split); ok {
+		t.Fatal("{a, b} and {c, d} are disjoint quorums")
+	}
+
+	// The same, but c and d need a as well
+	split["c"] = QuorumSlice{Members: []string{"c", "d", "a"}, Threshold: 3}
+	split["d"] = QuorumSlice{Members: []string{"c", "d", "a"}, Threshold: 3}
+	if ok, _ := QuorumsIntersect(split); !ok {
+		t.Fatal("every quorum should now include a")
+	}
+
+	// Too many nodes to check
+	big := make(map[string]QuorumSlice)
+	bigMembers := []string{}
+	for i := 0; i <= MaxIntersectionNodes; i++ {
+		bigMembers = append(bigMembers, fmt.Sprintf("node%d", i))
+	}
+	for _, member := range bigMembers {
+		big[member] = QuorumSlice{Members: bigMembers, Threshold: len(bigMembers)}
+	}
+	if _, err := QuorumsIntersect(big); err == nil {
+		t.Fatal("a network that is too big to check should be an error")
+	}
+}
+
+func TestQuorumSliceValidate(t *testing.T) {
+	good := []QuorumSlice{
+		{Members: []string{"a", "b", "c"}, Threshold: 2},
+		{
+			Members:         []string{"a", "b"},
+			Weights:         map[string]int{"a": 3, "b": 1},
+			WeightThreshold: 4,
+		},
+		{
+			Members:   []string{"a"},
+			Threshold: 2,
+			Inner:     []QuorumSlice{{Members: []string{"b", "c"}, Threshold: 1}},
+		},
+	}
+	for _, qs := range good {
+		if err := qs.Validate(3); err != nil {
+			t.Fatalf("%+v should be valid: %s", qs, err)
+		}
+	}
+	bad := []QuorumSlice{
+		{Members: []string{"a", "b", "c", "d"}, Threshold: 2},
+		{Members: []string{"a", "b"}, Threshold: 0},
+		{Members: []string{"a", "b"}, Threshold: 3},
+		{Members: []string{"a", "a"}, Threshold: 1},
+		{
+			Members:         []string{"a", "b"},
+			Weights:         map[string]int{"a": 3, "b": -1},
+			WeightThreshold: 2,
+		},
+		{
+			Members:   []string{"a"},
+			Threshold: 1,
+			Inner:     []QuorumSlice{{Members: []string{"b", "c"}, Threshold: 3}},
+		},
+		{
+			Members:   []string{"a", "b"},
+			Threshold: 1,
+			Inner:     []QuorumSlice{{Members: []string{"b", "c"}, Threshold: 1}},
+		},
+	}
+	for _, qs := range bad {
+		if qs.Validate(3) == nil {
+			t.Fatalf("%+v should be invalid", qs)
+		}
+	}
+}
+
+func TestQuorumMap(t *testing.T) {
+	qm := NewQuorumMap()
+	old := QuorumSlice{Members: []string{"a", "b"}, Threshold: 2}
+	newer := QuorumSlice{Members: []string{"a", "b", "c"}, Threshold: 2}
+	qm.Update("b", 1, old)
+	qm.Update("a", 1, old)
+	qm.Update("b", 2, newer)
+
+	if !reflect.DeepEqual(qm.NodesList(), []string{"a", "b"}) {
+		t.Fatalf("bad NodesList: %v", qm.NodesList())
+	}
+	qs, ok := qm.Get("b")
+	if !ok || !reflect.DeepEqual(qs, newer) {
+		t.Fatalf("expected the newest slice for b, got %+v", qs)
+	}
+	if qm.Update("b", 1, old) {
+		t.Fatal("a slice from an older slot should not be recorded")
+	}
+	if qs, _ := qm.Get("b"); !reflect.DeepEqual(qs, newer) {
+		t.Fatal("an older slot should not replace a newer slice")
+	}
+	if _, ok := qm.Get("c"); ok {
+		t.Fatal("c has not advertised a slice")
+	}
+	if ok, err := qm.QuorumsIntersect(); !ok || err != nil {
+		t.Fatal("a and b should only form one quorum")
+	}
+}
@@ -2,35 +2,59 @@ package consensus
 
 import (
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"sort"
 
-	"golang.org/x/crypto/sha3"
+	"coinkit/util"
 )
 
+// HashBytes returns the raw util.Hash digest of x.
+func HashBytes(x string) []byte {
+	return util.Hash([]byte(x))
+}
+
+// HashString returns the digest of x in unpadded standard base64.
 func HashString(x string) string {
-	h := sha3.New512()
-	hashBytes := h.Sum([]byte(x))
-	return base64.RawStdEncoding.EncodeToString(hashBytes)
+	return base64.RawStdEncoding.EncodeToString(HashBytes(x))
+}
+
+// HashStringURL is like HashString but uses the URL-safe base64 alphabet,
+// so the result can go in paths and query strings.
+func HashStringURL(x string) string {
+	return base64.RawURLEncoding.EncodeToString(HashBytes(x))
 }
 
 // SeedSort sorts in a way that is repeatable depending on the seed string.
+// Duplicate inputs are all kept.
 // Does not mutate input
 func SeedSort(seed string, input []string) []string {
-	m := make(map[string]string)
-	keys := []string{}
-	for _, x := range input {
-		hashed := HashString(seed + x)
-		m[hashed] = x
-		keys = append(keys, hashed)
-	}
-	sort.Strings(keys)
+	indices := SeedSortBy(seed, len(input), func(i int) string {
+		return input[i]
+	})
 	answer := []string{}
-	for _, key := range keys {
-		answer = append(answer, m[key])
+	for _, i := range indices {
+		answer = append(answer, input[i])
 	}
 	return answer
 }
 
+// SeedSortBy returns a permutation of the indices 0..n-1, in the order that
+// SeedSort would put the ids in. Callers can use it to reorder any slice.
+// Indices with the same id keep their relative order.
+func SeedSortBy(seed string, n int, id func(i int) string) []int {
+	hashes := []string{}
+	indices := []int{}
+	for i := 0; i < n; i++ {
+		hashes = append(hashes, HashString(seed+id(i)))
+		indices = append(indices, i)
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return hashes[indices[i]] < hashes[indices[j]]
+	})
+	return indices
+}
+
 // SeedPriority returns the index of node in the seed-sorted list
 func SeedPriority(seed string, input []string, node string) int {
 	sorted := SeedSort(seed, input)
@@ -41,3 +65,28 @@ func SeedPriority(seed string, input []string, node string) int {
 	}
 	panic("we have no seed priority")
 }
+
+// SeedLeader returns the node with priority 0 for this seed.
+func SeedLeader(seed string, nodes []string) (string, error) {
+	leaders, err := SeedLeaders(seed, nodes, 1)
+	if err != nil {
+		return "", err
+	}
+	return leaders[0], nil
+}
+
+// SeedLeaders returns the k highest-priority nodes for this seed, highest first.
+// If there are fewer than k nodes, it returns all of them.
+func SeedLeaders(seed string, nodes []string, k int) ([]string, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("cannot pick a leader from no nodes")
+	}
+	if k < 0 {
+		return nil, fmt.Errorf("cannot pick %d leaders", k)
+	}
+	sorted := SeedSort(seed, nodes)
+	if k < len(sorted) {
+		sorted = sorted[:k]
+	}
+	return sorted, nil
+}
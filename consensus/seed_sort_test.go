@@ -1,6 +1,7 @@
 package consensus
 
 import (
+	"encoding/base64"
 	"strings"
 	"testing"
 )
@@ -28,3 +29,139 @@ func TestSeedSort(t *testing.T) {
 	testWithSeed("null", t)
 	testWithSeed("aieeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", t)
 }
+
+func TestSeedLeader(t *testing.T) {
+	nodes := []string{"foo", "bar", "baz", "qux", "1", "2"}
+	leaders := make(map[string]bool)
+	for _, seed := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		leader, err := SeedLeader(seed, nodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := SeedLeader(seed, nodes)
+		if leader != again {
+			t.Fatalf("seed %s picked %s and then %s", seed, leader, again)
+		}
+		if SeedPriority(seed, nodes, leader) != 0 {
+			t.Fatalf("seed %s leader %s should have priority 0", seed, leader)
+		}
+		top, err := SeedLeaders(seed, nodes, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(top) != 3 || top[0] != leader {
+			t.Fatalf("bad top leaders for seed %s: %+v", seed, top)
+		}
+		leaders[leader] = true
+	}
+	if len(leaders) < 2 {
+		t.Fatal("changing the seed should change the leader")
+	}
+
+	all, _ := SeedLeaders("a", nodes, 100)
+	if len(all) != len(nodes) {
+		t.Fatalf("asking for too many leaders should return them all: %+v", all)
+	}
+	if _, err := SeedLeader("a", []string{}); err == nil {
+		t.Fatal("picking a leader from no nodes should fail")
+	}
+	if _, err := SeedLeaders("a", nodes, -1); err == nil {
+		t.Fatal("picking a negative number of leaders should fail")
+	}
+}
+
+func TestHashString(t *testing.T) {
+	inputs := []string{"", "a", "b", "ab", "a,b", "aieeeeeeeeeeeeeeeeeeeee"}
+	seen := make(map[string]bool)
+	length := len(HashString("a"))
+	for _, x := range inputs {
+		h := HashString(x)
+		if len(h) != length {
+			t.Fatalf("hash of %s has length %d, not %d", x, len(h), length)
+		}
+		if seen[h] {
+			t.Fatalf("hash collision on %s", x)
+		}
+		seen[h] = true
+		if h != HashString(x) {
+			t.Fatalf("hash of %s is not stable", x)
+		}
+	}
+
+	// The hash must not just be the input with a constant tacked on
+	encoded := base64.RawStdEncoding.EncodeToString([]byte("abc"))
+	if strings.HasPrefix(HashString("abc"), encoded) {
+		t.Fatal("the hash should not start with the encoded input")
+	}
+}
+
+func TestHashBytesRoundTrip(t *testing.T) {
+	for _, x := range []string{"", "a", "ab", "aieeeeeeeeeeeeeeeeeeeee"} {
+		raw := HashBytes(x)
+		decoded, err := base64.RawStdEncoding.DecodeString(HashString(x))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != string(raw) {
+			t.Fatalf("decoding HashString(%q) did not give HashBytes", x)
+		}
+		decoded, err = base64.RawURLEncoding.DecodeString(HashStringURL(x))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != string(raw) {
+			t.Fatalf("decoding HashStringURL(%q) did not give HashBytes", x)
+		}
+		if strings.ContainsAny(HashStringURL(x), "+/") {
+			t.Fatalf("HashStringURL(%q) is not URL-safe", x)
+		}
+	}
+}
+
+func TestSeedSortDuplicates(t *testing.T) {
+	sorted := SeedSort("seed", []string{"a", "a", "b"})
+	if len(sorted) != 3 {
+		t.Fatalf("duplicates were dropped: %+v", sorted)
+	}
+	count := 0
+	for _, x := range sorted {
+		if x == "a" {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Fatalf("expected both copies of a: %+v", sorted)
+	}
+}
+
+func TestSeedSortBy(t *testing.T) {
+	type node struct {
+		id     string
+		weight int
+	}
+	nodes := []node{{"foo", 1}, {"bar", 2}, {"baz", 3}, {"foo", 4}, {"qux", 5}}
+	ids := []string{}
+	for _, n := range nodes {
+		ids = append(ids, n.id)
+	}
+	for _, seed := range []string{"", "yolp", "boink"} {
+		indices := SeedSortBy(seed, len(nodes), func(i int) string {
+			return nodes[i].id
+		})
+		sorted := SeedSort(seed, ids)
+		if len(indices) != len(nodes) {
+			t.Fatalf("expected %d indices but got %d", len(nodes), len(indices))
+		}
+		seen := make(map[int]bool)
+		for i, index := range indices {
+			if seen[index] {
+				t.Fatalf("index %d appears twice", index)
+			}
+			seen[index] = true
+			if nodes[index].id != sorted[i] {
+				t.Fatalf("with seed %q, position %d is %s but SeedSort has %s",
+					seed, i, nodes[index].id, sorted[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package consensus
+
+import (
+	"testing"
+)
+
+func TestCombineDoesNotMutate(t *testing.T) {
+	vs := NewTestValueStore(0)
+	list := make([]SlotValue, 2, 10)
+	list[0] = SlotValue("c,a")
+	list[1] = SlotValue("b,a")
+	combined := vs.Combine(list)
+	if combined != SlotValue("a,b,c") {
+		t.Fatalf("bad combine: %s", combined)
+	}
+	if len(list) != 2 || list[0] != SlotValue("c,a") || list[1] != SlotValue("b,a") {
+		t.Fatalf("Combine mutated its argument: %+v", list)
+	}
+	if extra := list[:3]; extra[2] != SlotValue("") {
+		t.Fatalf("Combine wrote past the end of its argument: %+v", extra)
+	}
+}
@@ -3,6 +3,7 @@ package currency
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 )
 
@@ -30,8 +31,59 @@ func StringifyAccount(a *Account) string {
 	return fmt.Sprintf("s%d:b%d", a.Sequence, a.Balance)
 }
 
+// Copy returns an independent copy of the account, or nil for nil.
+func (a *Account) Copy() *Account {
+	if a == nil {
+		return nil
+	}
+	answer := *a
+	return &answer
+}
+
 func (a Account) Bytes() []byte {
 	var buffer bytes.Buffer
 	binary.Write(&buffer, binary.LittleEndian, a)
 	return buffer.Bytes()
 }
+
+// CanAfford returns whether this account has enough balance to send amount,
+// paying fee on top of it.
+func (a *Account) CanAfford(amount uint64, fee uint64) bool {
+	cost := amount + fee
+	if cost < amount {
+		// Overflow
+		return false
+	}
+	return cost <= a.Balance
+}
+
+// Apply debits amount plus fee from this account and increments its sequence.
+// If the account cannot afford it, the account is left unchanged.
+func (a *Account) Apply(amount uint64, fee uint64) error {
+	if !a.CanAfford(amount, fee) {
+		return errors.New("insufficient funds")
+	}
+	if err := SubBalance(a, amount+fee); err != nil {
+		return err
+	}
+	a.Sequence++
+	return nil
+}
+
+// AddBalance credits delta to the account, failing rather than overflowing.
+func AddBalance(a *Account, delta uint64) error {
+	if a.Balance+delta < a.Balance {
+		return errors.New("balance overflow")
+	}
+	a.Balance += delta
+	return nil
+}
+
+// SubBalance debits delta from the account, failing rather than underflowing.
+func SubBalance(a *Account, delta uint64) error {
+	if delta > a.Balance {
+		return errors.New("balance underflow")
+	}
+	a.Balance -= delta
+	return nil
+}
@@ -0,0 +1,57 @@
+package currency
+
+// AccountCache layers changes over a base set of accounts without copying
+// the whole thing. Accounts are copied the first time they are read, so
+// nothing done through the cache affects the base until Commit is called.
+// AccountCache is not threadsafe.
+type AccountCache struct {
+	base map[string]*Account
+
+	// Copies of every account that has been read or written
+	cache map[string]*Account
+
+	// The accounts that have been written
+	dirty map[string]bool
+}
+
+func NewAccountCache(base map[string]*Account) *AccountCache {
+	return &AccountCache{
+		base:  base,
+		cache: make(map[string]*Account),
+		dirty: make(map[string]bool),
+	}
+}
+
+// Get returns the cached copy of an account, or nil if there is no such
+// account. Changes to it are only committed if Set is called.
+func (c *AccountCache) Get(key string) *Account {
+	if account, ok := c.cache[key]; ok {
+		return account
+	}
+	account := c.base[key].Copy()
+	c.cache[key] = account
+	return account
+}
+
+func (c *AccountCache) Set(key string, account *Account) {
+	c.cache[key] = account
+	c.dirty[key] = true
+}
+
+// Process returns false if the transaction cannot be processed
+func (c *AccountCache) Process(t *Transaction) bool {
+	return processTransaction(c, t) == nil
+}
+
+// Dirty returns how many accounts have been written.
+func (c *AccountCache) Dirty() int {
+	return len(c.dirty)
+}
+
+// Commit writes the accounts that have been written back to the base.
+func (c *AccountCache) Commit() {
+	for key, _ := range c.dirty {
+		c.base[key] = c.cache[key].Copy()
+	}
+	c.dirty = make(map[string]bool)
+}
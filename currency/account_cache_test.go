@@ -0,0 +1,59 @@
+package currency
+
+import (
+	"testing"
+)
+
+func TestAccountCacheReadsDoNotMutate(t *testing.T) {
+	base := map[string]*Account{
+		"a": &Account{Sequence: 1, Balance: 10},
+	}
+	c := NewAccountCache(base)
+	a := c.Get("a")
+	a.Balance = 1000
+	if base["a"].Balance != 10 {
+		t.Fatal("changing a cached account should not change the base")
+	}
+	if c.Get("a").Balance != 1000 {
+		t.Fatal("the cache should return the same copy every time")
+	}
+	if c.Get("nobody") != nil {
+		t.Fatal("a missing account should be nil")
+	}
+	c.Commit()
+	if base["a"].Balance != 10 || len(base) != 1 {
+		t.Fatal("accounts that were only read should not be committed")
+	}
+}
+
+func TestAccountCacheCommit(t *testing.T) {
+	t1 := makeTestTransaction(1)
+	base := map[string]*Account{
+		t1.From:     &Account{Sequence: 0, Balance: 10},
+		"untouched": &Account{Sequence: 5, Balance: 5},
+	}
+	untouched := base["untouched"]
+	c := NewAccountCache(base)
+	if !c.Process(t1.Transaction) {
+		t.Fatal("the transaction should process")
+	}
+	if base[t1.From].Balance != 10 {
+		t.Fatal("processing should not change the base before a commit")
+	}
+	if c.Dirty() != 2 {
+		t.Fatalf("expected two dirty accounts but got %d", c.Dirty())
+	}
+	c.Commit()
+	if base[t1.From].Balance != 8 || base[t1.From].Sequence != 1 {
+		t.Fatalf("bad sender after commit: %s", StringifyAccount(base[t1.From]))
+	}
+	if base[t1.To].Balance != 1 {
+		t.Fatalf("bad recipient after commit: %s", StringifyAccount(base[t1.To]))
+	}
+	if base["untouched"] != untouched {
+		t.Fatal("an untouched account should not be committed")
+	}
+	if c.Dirty() != 0 {
+		t.Fatal("nothing should be dirty after a commit")
+	}
+}
@@ -1,6 +1,11 @@
 package currency
 
-import ()
+import (
+	"errors"
+	"fmt"
+
+	"coinkit/util"
+)
 
 // Used to map a public key to its Account
 type AccountMap struct {
@@ -67,21 +72,32 @@ func (m *AccountMap) Set(key string, account *Account) {
 	m.data[key] = account
 }
 
+// accountStore is anything accounts can be read from and written to.
+type accountStore interface {
+	Get(key string) *Account
+	Set(key string, account *Account)
+}
+
 // Validate returns whether this transaction is valid
 func (m *AccountMap) Validate(t *Transaction) bool {
-	account := m.Get(t.From)
+	return validateTransaction(m, t) == nil
+}
+
+// validateTransaction returns an error describing why t can't be applied to
+// the accounts in store, or nil if it can.
+func validateTransaction(store accountStore, t *Transaction) error {
+	account := store.Get(t.From)
 	if account == nil {
-		return false
+		return fmt.Errorf("unknown account %s", util.Shorten(t.From))
 	}
 	if account.Sequence+1 != t.Sequence {
-		return false
+		return fmt.Errorf("sequence is %d but should be %d",
+			t.Sequence, account.Sequence+1)
 	}
-	cost := t.Amount + t.Fee
-	if cost > account.Balance {
-		return false
+	if !account.CanAfford(t.Amount, t.Fee) {
+		return fmt.Errorf("it costs more than the balance of %d", account.Balance)
 	}
-
-	return true
+	return nil
 }
 
 func (m *AccountMap) SetBalance(owner string, amount uint64) {
@@ -95,51 +111,69 @@ func (m *AccountMap) SetBalance(owner string, amount uint64) {
 
 // Process returns false if the transaction cannot be processed
 func (m *AccountMap) Process(t *Transaction) bool {
-	if !m.Validate(t) {
-		return false
+	return processTransaction(m, t) == nil
+}
+
+// processTransaction applies t to the accounts in store, or returns an error
+// describing why it can't, leaving store unchanged.
+func processTransaction(store accountStore, t *Transaction) error {
+	if err := validateTransaction(store, t); err != nil {
+		return err
 	}
-	source := m.Get(t.From)
-	target := m.Get(t.To)
+	source := store.Get(t.From)
+	target := store.Get(t.To)
 	if target == nil {
 		target = &Account{}
 	}
-	newSource := &Account{
-		Sequence: t.Sequence,
-		Balance:  source.Balance - t.Amount - t.Fee,
+	newSource := source.Copy()
+	if err := newSource.Apply(t.Amount, t.Fee); err != nil {
+		return err
 	}
-	newTarget := &Account{
-		Sequence: target.Sequence,
-		Balance:  target.Balance + t.Amount,
+	newTarget := target.Copy()
+	if err := AddBalance(newTarget, t.Amount); err != nil {
+		return err
 	}
-	m.Set(t.From, newSource)
-	m.Set(t.To, newTarget)
-	return true
+	store.Set(t.From, newSource)
+	store.Set(t.To, newTarget)
+	return nil
 }
 
 // ProcessChunk returns false if the whole chunk cannot be processed.
 // In this situation, the account map may be left with only some of
 // the transactions in the chunk processed.
 func (m *AccountMap) ProcessChunk(chunk *LedgerChunk) bool {
+	return m.processChunk(chunk) == nil
+}
+
+// processChunk is like ProcessChunk but describes why a chunk is invalid.
+func (m *AccountMap) processChunk(chunk *LedgerChunk) error {
 	if chunk == nil {
-		return false
+		return errors.New("nil chunk")
 	}
-	if len(chunk.Transactions) > MaxChunkSize {
-		return false
+	if !chunk.WithinSizeLimit() {
+		return fmt.Errorf("chunk has %d transactions but the max is %d",
+			len(chunk.Transactions), MaxChunkSize)
 	}
 
-	for _, t := range chunk.Transactions {
-		if t == nil || !t.Verify() || !m.Process(t.Transaction) {
-			return false
+	if _, err := chunk.VerifySignatures(); err != nil {
+		return err
+	}
+	for i, t := range chunk.Transactions {
+		if !m.Process(t.Transaction) {
+			return fmt.Errorf("transaction %d cannot be processed: %s",
+				i, t.Transaction)
 		}
 	}
 
 	for owner, account := range chunk.State {
 		if !m.CheckEqual(owner, account) {
-			return false
+			return fmt.Errorf("state for %s should be %s but is %s",
+				util.Shorten(owner), StringifyAccount(m.Get(owner)),
+				StringifyAccount(account))
 		}
 	}
 
-	return true
+	return nil
 }
 
 // ValidateChunk returns true iff ProcessChunk could succeed.
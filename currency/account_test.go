@@ -1,6 +1,7 @@
 package currency
 
 import (
+	"math"
 	"testing"
 )
 
@@ -31,3 +32,90 @@ func TestTransactionProcessing(t *testing.T) {
 		t.Fatalf("validation should reject replay attacks")
 	}
 }
+
+func TestAccountApply(t *testing.T) {
+	a := &Account{Sequence: 4, Balance: 100}
+	if a.CanAfford(98, 3) {
+		t.Fatal("the fee should count against the balance")
+	}
+	if a.Apply(98, 3) == nil {
+		t.Fatal("applying more than the balance should fail")
+	}
+	if a.Balance != 100 || a.Sequence != 4 {
+		t.Fatalf("a failed apply should not change the account: %s",
+			StringifyAccount(a))
+	}
+	if a.CanAfford(math.MaxUint64, 2) {
+		t.Fatal("an overflowing cost should not be affordable")
+	}
+	if !a.CanAfford(97, 3) {
+		t.Fatal("the exact balance should be affordable")
+	}
+	if err := a.Apply(97, 3); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance != 0 || a.Sequence != 5 {
+		t.Fatalf("bad account after apply: %s", StringifyAccount(a))
+	}
+}
+
+func TestBalanceOverflow(t *testing.T) {
+	a := &Account{Balance: math.MaxUint64 - 1}
+	if err := AddBalance(a, 1); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance != math.MaxUint64 {
+		t.Fatalf("bad balance: %d", a.Balance)
+	}
+	if AddBalance(a, 1) == nil {
+		t.Fatal("adding past MaxUint64 should fail")
+	}
+	if a.Balance != math.MaxUint64 {
+		t.Fatal("a failed add should not change the balance")
+	}
+	if err := SubBalance(a, math.MaxUint64); err != nil {
+		t.Fatal(err)
+	}
+	if SubBalance(a, 1) == nil {
+		t.Fatal("subtracting below zero should fail")
+	}
+	if a.Balance != 0 {
+		t.Fatal("a failed subtract should not change the balance")
+	}
+}
+
+func TestProcessRejectsOverflowingCredit(t *testing.T) {
+	m := NewAccountMap()
+	m.SetBalance("alice", 10)
+	m.SetBalance("bob", math.MaxUint64)
+	payBob := &Transaction{
+		Sequence: 1,
+		Amount:   5,
+		Fee:      1,
+		From:     "alice",
+		To:       "bob",
+	}
+	if m.Process(payBob) {
+		t.Fatal("crediting bob past MaxUint64 should fail")
+	}
+	if !m.CheckEqual("alice", &Account{Sequence: 0, Balance: 10}) {
+		t.Fatal("a failed payment should not debit alice")
+	}
+}
+
+func TestAccountCopy(t *testing.T) {
+	a := &Account{Sequence: 1, Balance: 2}
+	b := a.Copy()
+	if *a != *b {
+		t.Fatal("a copy should equal the original")
+	}
+	b.Sequence = 3
+	b.Balance = 4
+	if a.Sequence != 1 || a.Balance != 2 {
+		t.Fatal("mutating a copy should not affect the original")
+	}
+	var none *Account
+	if none.Copy() != nil {
+		t.Fatal("a copy of nil should be nil")
+	}
+}
@@ -2,11 +2,13 @@ package currency
 
 import (
 	"encoding/base64"
+	"fmt"
+	"runtime"
 	"sort"
+	"sync"
 
-	"golang.org/x/crypto/sha3"
-	
 	"coinkit/consensus"
+	"coinkit/util"
 )
 
 // MaxChunkSize defines how many items can be put in a chunk
@@ -22,22 +24,220 @@ type LedgerChunk struct {
 	State map[string]*Account
 }
 
+// SnapshotState copies the accounts that are mentioned in txs, so that the
+// copy can be used as LedgerChunk.State without aliasing accounts.
+// Accounts that don't exist in accounts are left out.
+func SnapshotState(
+	accounts map[string]*Account, txs []*SignedTransaction) map[string]*Account {
+	state := make(map[string]*Account)
+	for _, t := range txs {
+		if t == nil || t.Transaction == nil {
+			continue
+		}
+		for _, owner := range []string{t.From, t.To} {
+			if account := accounts[owner]; account != nil {
+				state[owner] = account.Copy()
+			}
+		}
+	}
+	return state
+}
+
 func (c *LedgerChunk) Hash() consensus.SlotValue {
-	h := sha3.New512()
+	data := []byte{}
 	for _, t := range c.Transactions {
-		h.Write([]byte(t.Signature))
+		data = append(data, []byte(t.Signature)...)
 	}
+	for _, key := range c.Accounts() {
+		data = append(data, []byte(key)...)
+		account := c.State[key]
+		data = append(data, account.Bytes()...)
+	}
+	return consensus.SlotValue(base64.RawStdEncoding.EncodeToString(util.Hash(data)))
+}
+
+// Accounts returns the keys of the accounts in c.State, sorted.
+func (c *LedgerChunk) Accounts() []string {
 	keys := []string{}
 	for key, _ := range c.State {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
-	for _, key := range keys {
-		h.Write([]byte(key))
-		account := c.State[key]
-		h.Write(account.Bytes())
+	return keys
+}
+
+// addChecked returns a+b, and false if that overflows.
+func addChecked(a, b uint64) (uint64, bool) {
+	if a+b < a {
+		return 0, false
+	}
+	return a + b, true
+}
+
+// TotalBalance returns the sum of the balances in c.State.
+// The bool is false if the sum overflows.
+func (c *LedgerChunk) TotalBalance() (uint64, bool) {
+	total := uint64(0)
+	for _, account := range c.State {
+		if account == nil {
+			continue
+		}
+		var ok bool
+		if total, ok = addChecked(total, account.Balance); !ok {
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// WithinSizeLimit returns whether this chunk has no more than MaxChunkSize
+// transactions.
+func (c *LedgerChunk) WithinSizeLimit() bool {
+	return len(c.Transactions) <= MaxChunkSize
+}
+
+// Validate checks that applying the transactions in this chunk to the prev
+// state is valid, and yields the accounts in c.State.
+// prev is not modified.
+func (c *LedgerChunk) Validate(prev map[string]*Account) error {
+	m := NewAccountMap()
+	for owner, account := range prev {
+		m.Set(owner, account)
+	}
+	return m.processChunk(c)
+}
+
+// ConservesValue checks that no money is created or destroyed by this chunk,
+// other than the fees that are paid. The total balance in c.State must equal
+// the total balance of the same accounts in prev, minus the fees.
+// It returns whether value is conserved along with the total of the fees.
+// If any of the sums overflow, value is not conserved.
+func (c *LedgerChunk) ConservesValue(prev map[string]*Account) (bool, uint64) {
+	var ok bool
+	before := uint64(0)
+	for owner, _ := range c.State {
+		account := prev[owner]
+		if account == nil {
+			continue
+		}
+		if before, ok = addChecked(before, account.Balance); !ok {
+			return false, 0
+		}
+	}
+	fees := uint64(0)
+	for _, t := range c.Transactions {
+		if t == nil || t.Transaction == nil {
+			continue
+		}
+		if fees, ok = addChecked(fees, t.Fee); !ok {
+			return false, 0
+		}
+	}
+	after, ok := c.TotalBalance()
+	if !ok || before < fees {
+		return false, fees
+	}
+	return before-fees == after, fees
+}
+
+// ApplyChunk processes the chunk on top of accounts, replacing the accounts
+// it changes. Every transaction must have the next sequence number for its
+// sender, so applying the same chunk twice fails instead of double-debiting.
+// If there is an error, accounts is left unchanged.
+func ApplyChunk(accounts map[string]*Account, c *LedgerChunk) error {
+	m := NewAccountMap()
+	for owner, account := range accounts {
+		m.Set(owner, account)
+	}
+	if err := m.processChunk(c); err != nil {
+		return err
+	}
+	for _, t := range c.Transactions {
+		accounts[t.From] = m.Get(t.From).Copy()
+		accounts[t.To] = m.Get(t.To).Copy()
+	}
+	return nil
+}
+
+// CheckExpiry returns an error if any transaction in the chunk has expired
+// by the given slot, so the chunk can't be used for that slot.
+func (c *LedgerChunk) CheckExpiry(slot int) error {
+	for i, t := range c.Transactions {
+		if t != nil && t.Transaction != nil && t.Expired(slot) {
+			return fmt.Errorf("transaction %d expired after slot %d, before slot %d",
+				i, t.ValidUntilSlot, slot)
+		}
+	}
+	return nil
+}
+
+// DryRun reports what would go wrong applying the chunk's transactions on
+// top of prev, without changing prev.
+// The result has one entry per transaction, nil for the ones that would
+// apply. A failing transaction is skipped, so later ones are checked as if
+// it were not there. c.State is not checked; Validate does that.
+func (c *LedgerChunk) DryRun(prev map[string]*Account) []error {
+	m := NewAccountMap()
+	for owner, account := range prev {
+		m.Set(owner, account)
+	}
+	errs := make([]error, len(c.Transactions))
+	for i, t := range c.Transactions {
+		if t == nil || !t.Verify() {
+			errs[i] = fmt.Errorf("transaction %d does not verify", i)
+			continue
+		}
+		if err := processTransaction(m, t.Transaction); err != nil {
+			errs[i] = fmt.Errorf("transaction %d cannot be processed: %s", i, err)
+		}
+	}
+	return errs
+}
+
+// VerifySignatures checks every transaction in the chunk, spreading the work
+// over one goroutine per CPU.
+// It returns the lowest index of a transaction that fails, along with an
+// error, or -1 and nil if they all verify.
+func (c *LedgerChunk) VerifySignatures() (int, error) {
+	n := len(c.Transactions)
+	valid := make([]bool, n)
+	indices := make(chan int, n)
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				valid[i] = c.Transactions[i].Verify()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, ok := range valid {
+		if !ok {
+			return i, fmt.Errorf("transaction %d does not verify", i)
+		}
+	}
+	return -1, nil
+}
+
+// VerifyExternalize returns whether m externalized exactly this chunk.
+// A chunk should only be applied for a slot if this holds.
+func VerifyExternalize(m *consensus.ExternalizeMessage, c *LedgerChunk) bool {
+	if m == nil || c == nil {
+		return false
 	}
-	return consensus.SlotValue(base64.RawStdEncoding.EncodeToString(h.Sum(nil)))
+	return m.X == c.Hash()
 }
 
 func (c *LedgerChunk) String() string {
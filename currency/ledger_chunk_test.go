@@ -1,7 +1,14 @@
 package currency
 
 import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
 	"testing"
+
+	"coinkit/consensus"
+	"coinkit/util"
 )
 
 func TestLedgerChunkHashing(t *testing.T) {
@@ -66,3 +73,328 @@ func TestLedgerChunkHashing(t *testing.T) {
 		t.Fatal("chunk1 should != chunk4")
 	}
 }
+
+func TestLedgerChunkValidation(t *testing.T) {
+	t1 := makeTestTransaction(1)
+	t2 := makeTestTransaction(2)
+	prev := map[string]*Account{
+		t1.From: &Account{Sequence: 0, Balance: 10},
+		t2.From: &Account{Sequence: 0, Balance: 10},
+	}
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{t1, t2},
+		State: map[string]*Account{
+			t1.From: &Account{Sequence: 1, Balance: 8},
+			t2.From: &Account{Sequence: 1, Balance: 6},
+			t1.To:   &Account{Sequence: 0, Balance: 3},
+		},
+	}
+	if err := chunk.Validate(prev); err != nil {
+		t.Fatal(err)
+	}
+	if prev[t1.From].Balance != 10 || prev[t1.From].Sequence != 0 {
+		t.Fatal("validation should not modify the previous state")
+	}
+
+	chunk.State[t1.To] = &Account{Sequence: 0, Balance: 4}
+	if chunk.Validate(prev) == nil {
+		t.Fatal("a tampered balance should fail validation")
+	}
+
+	chunk.State[t1.To] = &Account{Sequence: 0, Balance: 3}
+	prev[t2.From] = &Account{Sequence: 0, Balance: 3}
+	if chunk.Validate(prev) == nil {
+		t.Fatal("an unaffordable transaction should fail validation")
+	}
+}
+
+func TestLedgerChunkHashIsStable(t *testing.T) {
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{makeTestTransaction(1)},
+		State:        make(map[string]*Account),
+	}
+	for i := 0; i < 20; i++ {
+		chunk.State[fmt.Sprintf("account%d", i)] = &Account{
+			Sequence: uint32(i),
+			Balance:  uint64(i * 10),
+		}
+	}
+	hash := chunk.Hash()
+	for i := 0; i < 100; i++ {
+		if chunk.Hash() != hash {
+			t.Fatal("hashing the same chunk should always give the same hash")
+		}
+	}
+}
+
+func TestLedgerChunkAccounts(t *testing.T) {
+	a1 := &Account{Sequence: 1, Balance: 2}
+	a2 := &Account{Sequence: 1, Balance: 20}
+	a3 := &Account{Sequence: 4, Balance: 200}
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{makeTestTransaction(1)},
+		State: map[string]*Account{
+			"a3": a3,
+			"a1": a1,
+			"a2": a2,
+		},
+	}
+	accounts := chunk.Accounts()
+	if len(accounts) != 3 || accounts[0] != "a1" || accounts[1] != "a2" ||
+		accounts[2] != "a3" {
+		t.Fatalf("accounts are not sorted: %+v", accounts)
+	}
+	if total, ok := chunk.TotalBalance(); !ok || total != 222 {
+		t.Fatalf("bad total balance: %d", total)
+	}
+}
+
+func TestLedgerChunkConservesValue(t *testing.T) {
+	t1 := makeTestTransaction(1)
+	t2 := makeTestTransaction(2)
+	prev := map[string]*Account{
+		t1.From: &Account{Sequence: 0, Balance: 10},
+		t2.From: &Account{Sequence: 0, Balance: 10},
+	}
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{t1, t2},
+		State: map[string]*Account{
+			t1.From: &Account{Sequence: 1, Balance: 8},
+			t2.From: &Account{Sequence: 1, Balance: 6},
+			t1.To:   &Account{Sequence: 0, Balance: 3},
+		},
+	}
+	ok, fees := chunk.ConservesValue(prev)
+	if !ok {
+		t.Fatal("a valid chunk should conserve value")
+	}
+	if fees != 3 {
+		t.Fatalf("expected 3 in fees but got %d", fees)
+	}
+
+	// Mint some extra coins for the recipient
+	chunk.State[t1.To] = &Account{Sequence: 0, Balance: 1000}
+	ok, _ = chunk.ConservesValue(prev)
+	if ok {
+		t.Fatal("a chunk that mints coins should not conserve value")
+	}
+
+	// Mint coins with balances that wrap around to the right total
+	chunk.State[t1.From] = &Account{Sequence: 1, Balance: 8}
+	chunk.State[t2.From] = &Account{Sequence: 1, Balance: math.MaxUint64}
+	chunk.State[t1.To] = &Account{Sequence: 0, Balance: 10}
+	if _, ok := chunk.TotalBalance(); ok {
+		t.Fatal("an overflowing total balance should be reported")
+	}
+	ok, _ = chunk.ConservesValue(prev)
+	if ok {
+		t.Fatal("a chunk whose balances overflow should not conserve value")
+	}
+}
+
+func TestLedgerChunkSizeLimit(t *testing.T) {
+	prev := make(map[string]*Account)
+	chunk := &LedgerChunk{State: make(map[string]*Account)}
+	for i := 1; i <= MaxChunkSize+1; i++ {
+		st := makeTestTransaction(i)
+		prev[st.From] = &Account{Sequence: 0, Balance: uint64(2 * i)}
+		chunk.Transactions = append(chunk.Transactions, st)
+	}
+	if chunk.WithinSizeLimit() {
+		t.Fatal("the chunk should be over the size limit")
+	}
+	if chunk.Validate(prev) == nil {
+		t.Fatal("an oversize chunk should fail validation")
+	}
+
+	chunk.Transactions = chunk.Transactions[:MaxChunkSize]
+	if !chunk.WithinSizeLimit() {
+		t.Fatal("the chunk should be within the size limit")
+	}
+}
+
+func TestSnapshotState(t *testing.T) {
+	t1 := makeTestTransaction(1)
+	t2 := makeTestTransaction(2)
+	accounts := map[string]*Account{
+		t1.From:     &Account{Sequence: 1, Balance: 10},
+		t1.To:       &Account{Sequence: 0, Balance: 5},
+		"untouched": &Account{Sequence: 3, Balance: 7},
+	}
+	state := SnapshotState(accounts, []*SignedTransaction{t1, t2, nil})
+	if len(state) != 2 {
+		t.Fatalf("expected only the two existing touched accounts: %+v", state)
+	}
+	if state[t1.From].Balance != 10 || state[t1.To].Balance != 5 {
+		t.Fatal("bad snapshot")
+	}
+
+	accounts[t1.From].Balance = 1000
+	accounts[t1.To].Sequence = 9
+	if state[t1.From].Balance != 10 || state[t1.To].Sequence != 0 {
+		t.Fatal("the snapshot should not change when the source does")
+	}
+	state[t1.From].Balance = 0
+	if accounts[t1.From].Balance != 1000 {
+		t.Fatal("the source should not change when the snapshot does")
+	}
+}
+
+func TestApplyChunkRejectsReplay(t *testing.T) {
+	t1 := makeTestTransaction(1)
+	t2 := makeTestTransaction(2)
+	accounts := map[string]*Account{
+		t1.From: &Account{Sequence: 0, Balance: 10},
+		t2.From: &Account{Sequence: 0, Balance: 10},
+	}
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{t1, t2},
+		State: map[string]*Account{
+			t1.From: &Account{Sequence: 1, Balance: 8},
+			t2.From: &Account{Sequence: 1, Balance: 6},
+			t1.To:   &Account{Sequence: 0, Balance: 3},
+		},
+	}
+	if err := ApplyChunk(accounts, chunk); err != nil {
+		t.Fatal(err)
+	}
+	if accounts[t1.From].Sequence != 1 || accounts[t1.To].Balance != 3 {
+		t.Fatalf("the chunk was not applied: %+v", accounts)
+	}
+
+	if ApplyChunk(accounts, chunk) == nil {
+		t.Fatal("applying the same chunk twice should fail")
+	}
+	if accounts[t1.From].Balance != 8 || accounts[t2.From].Balance != 6 ||
+		accounts[t1.To].Balance != 3 {
+		t.Fatal("a failed application should not change any balances")
+	}
+
+	chunk.State[t1.From].Balance = 0
+	if accounts[t1.From].Balance != 8 {
+		t.Fatal("applied accounts should not alias the chunk state")
+	}
+}
+
+func TestVerifyExternalize(t *testing.T) {
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{makeTestTransaction(1)},
+		State:        map[string]*Account{"a": &Account{Sequence: 1, Balance: 2}},
+	}
+	m := &consensus.ExternalizeMessage{I: 1, X: chunk.Hash()}
+	if !VerifyExternalize(m, chunk) {
+		t.Fatal("an externalize of the chunk hash should verify")
+	}
+
+	other := &LedgerChunk{
+		Transactions: []*SignedTransaction{makeTestTransaction(2)},
+		State:        map[string]*Account{"a": &Account{Sequence: 1, Balance: 2}},
+	}
+	if VerifyExternalize(m, other) {
+		t.Fatal("an externalize of a different chunk should not verify")
+	}
+	if VerifyExternalize(m, nil) || VerifyExternalize(nil, chunk) {
+		t.Fatal("nothing should verify against nil")
+	}
+}
+
+type identityHasher struct{}
+
+func (identityHasher) Hash(data []byte) []byte {
+	return data
+}
+
+func TestLedgerChunkHashWithStubHasher(t *testing.T) {
+	old := util.DefaultHasher
+	util.DefaultHasher = identityHasher{}
+	defer func() {
+		util.DefaultHasher = old
+	}()
+
+	tr := makeTestTransaction(1)
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{tr},
+		State: map[string]*Account{
+			"b": &Account{Sequence: 2, Balance: 3},
+			"a": &Account{Sequence: 1, Balance: 2},
+		},
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(string(chunk.Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := (&Account{Sequence: 1, Balance: 2}).Bytes()
+	b := (&Account{Sequence: 2, Balance: 3}).Bytes()
+	expected := tr.Signature + "a" + string(a) + "b" + string(b)
+	if string(decoded) != expected {
+		t.Fatalf("expected the hash input %q but got %q", expected, decoded)
+	}
+}
+
+func TestLedgerChunkVerifySignatures(t *testing.T) {
+	chunk := &LedgerChunk{State: make(map[string]*Account)}
+	for i := 1; i <= 50; i++ {
+		chunk.Transactions = append(chunk.Transactions, makeTestTransaction(i))
+	}
+	if i, err := chunk.VerifySignatures(); i != -1 || err != nil {
+		t.Fatalf("expected every transaction to verify, got %d: %v", i, err)
+	}
+
+	for _, bad := range []int{37, 41} {
+		chunk.Transactions[bad] = &SignedTransaction{
+			Transaction: chunk.Transactions[bad].Transaction,
+			Signature:   chunk.Transactions[12].Signature,
+		}
+	}
+	i, err := chunk.VerifySignatures()
+	if i != 37 || err == nil {
+		t.Fatalf("expected transaction 37 to fail first, got %d: %v", i, err)
+	}
+}
+
+func BenchmarkLedgerChunkVerifySignatures(b *testing.B) {
+	chunk := &LedgerChunk{State: make(map[string]*Account)}
+	for i := 1; i <= MaxChunkSize; i++ {
+		chunk.Transactions = append(chunk.Transactions, makeTestTransaction(i))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := chunk.VerifySignatures(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLedgerChunkDryRun(t *testing.T) {
+	t1 := makeTestTransaction(1)
+	t2 := makeTestTransaction(2)
+	t3 := makeTestTransaction(3)
+	t4 := makeTestTransaction(4)
+	prev := map[string]*Account{
+		t1.From: &Account{Sequence: 0, Balance: 10},
+		t2.From: &Account{Sequence: 5, Balance: 10},
+		t3.From: &Account{Sequence: 0, Balance: 10},
+		t4.From: &Account{Sequence: 0, Balance: 1},
+	}
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{t1, t2, t3, t4},
+		State:        make(map[string]*Account),
+	}
+
+	errs := chunk.DryRun(prev)
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(errs))
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("transactions 0 and 2 should be fine: %v", errs)
+	}
+	if errs[1] == nil || !strings.Contains(errs[1].Error(), "sequence") {
+		t.Fatalf("transaction 1 should have a bad sequence: %v", errs[1])
+	}
+	if errs[3] == nil || !strings.Contains(errs[3].Error(), "balance") {
+		t.Fatalf("transaction 3 should be unaffordable: %v", errs[3])
+	}
+	if prev[t1.From].Sequence != 0 || prev[t1.From].Balance != 10 {
+		t.Fatal("DryRun should not change prev")
+	}
+}
@@ -1,7 +1,9 @@
 package currency
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -24,6 +26,16 @@ type Transaction struct {
 	// How much the sender is willing to pay to get this transfer registered
 	// This is on top of the amount
 	Fee uint64
+
+	// The last slot this transaction can go in. Zero means it never expires.
+	// It is left out of the encoding when zero, so transactions signed
+	// before it existed still verify.
+	ValidUntilSlot int `json:",omitempty"`
+}
+
+// Expired returns whether it is too late to put t in the given slot.
+func (t *Transaction) Expired(slot int) bool {
+	return t.ValidUntilSlot != 0 && t.ValidUntilSlot < slot
 }
 
 func (t *Transaction) String() string {
@@ -31,12 +43,32 @@ func (t *Transaction) String() string {
 		t.Amount, util.Shorten(t.From), util.Shorten(t.To), t.Sequence, t.Fee)
 }
 
+// MinimumFee is the lowest fee CheckFee accepts when a minimum is required.
+// Tests use zero-fee transactions, so the minimum is not always enforced.
+const MinimumFee = 1
+
+// CheckFee returns an error if the account cannot pay the fee for t.
+// When requireMinimum is set, fees below MinimumFee are rejected as well.
+func CheckFee(t *Transaction, account *Account, requireMinimum bool) error {
+	if requireMinimum && t.Fee < MinimumFee {
+		return fmt.Errorf("fee of %d is below the minimum of %d", t.Fee, MinimumFee)
+	}
+	if account == nil || account.Balance < t.Fee {
+		return errors.New("insufficient balance to pay the fee")
+	}
+	return nil
+}
+
 type SignedTransaction struct {
 	*Transaction
 
 	// The signature to prove that the sender has signed this
 	// Nil if the transaction has not been signed
 	Signature string
+
+	// The length of the JSON encoding, cached by encodedSize.
+	// Zero means it has not been computed yet.
+	size int
 }
 
 // Signs the transaction with the provided keypair.
@@ -55,8 +87,31 @@ func (t *Transaction) SignWith(keyPair *util.KeyPair) *SignedTransaction {
 	}
 }
 
+// UnmarshalJSON decodes a signed transaction, canonicalizing its signature so
+// that a relayer can't make a second valid copy by changing its encoding.
+func (s *SignedTransaction) UnmarshalJSON(data []byte) error {
+	type plain SignedTransaction
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*s = SignedTransaction(decoded)
+	s.Signature = util.CanonicalSignature(s.Signature)
+	return nil
+}
+
+// Verify checks that the transaction is well-formed and signed by its sender.
+// It does not check that the sender can afford it, since that depends on the
+// state of the ledger.
 func (s *SignedTransaction) Verify() bool {
-	if s.Transaction == nil {
+	if s == nil || s.Transaction == nil {
+		return false
+	}
+	if s.Transaction.Amount == 0 {
+		return false
+	}
+	if s.Transaction.Amount+s.Transaction.Fee < s.Transaction.Amount {
+		// The total cost overflows
 		return false
 	}
 	if _, err := util.ReadPublicKey(s.Transaction.To); err != nil {
@@ -70,34 +125,105 @@ func (s *SignedTransaction) Verify() bool {
 	if err != nil {
 		return false
 	}
-	return util.Verify(pk, string(bytes), s.Signature)
+	return pk.Verify(string(bytes), s.Signature)
 }
 
-// HighestPriorityFirst is a comparator in the emirpasic/gods comparator style.
-// Negative return indicates a < b
-// Positive return indicates a > b
-// Comparison indicates overall "priority" putting the highest priority first.
-// This means that when a has a higher fee than b, a < b.
-func HighestPriorityFirst(a, b interface{}) int {
-	s1 := a.(*SignedTransaction)
-	s2 := b.(*SignedTransaction)
+// Hash identifies a transaction by the bytes that its sender signed.
+func (s *SignedTransaction) Hash() string {
+	bytes, err := json.Marshal(s.Transaction)
+	if err != nil {
+		panic("failed to hash transaction because json encoding failed")
+	}
+	return base64.RawStdEncoding.EncodeToString(util.Hash(bytes))
+}
+
+// Priority is the fee per byte of the serialized transaction.
+// Block space is what is scarce, so this is what the queue orders by.
+func (s *SignedTransaction) Priority() float64 {
+	return float64(s.Fee) / float64(s.encodedSize())
+}
 
+// encodedSize returns the length of the JSON encoding of s.
+// Priority is used in every comparison the queue makes, so the size is
+// only computed once. A signed transaction should not be modified anyway.
+func (s *SignedTransaction) encodedSize() int {
+	if s.size == 0 {
+		bytes, err := json.Marshal(s)
+		if err != nil {
+			panic("failed to size transaction because json encoding failed")
+		}
+		s.size = len(bytes)
+	}
+	return s.size
+}
+
+// A priorityKey has everything needed to compare transactions by priority.
+type priorityKey struct {
+	perByte   float64
+	fee       uint64
+	signature string
+}
+
+func (s *SignedTransaction) priorityKey() priorityKey {
+	return priorityKey{
+		perByte:   s.Priority(),
+		fee:       s.Fee,
+		signature: s.Signature,
+	}
+}
+
+// compareFees puts the higher fee first, breaking ties by signature.
+func compareFees(k1, k2 priorityKey) int {
 	switch {
-	case s1.Transaction.Fee > s2.Transaction.Fee:
-		// s1 is higher priority. so a < b
+	case k1.fee > k2.fee:
+		// k1 is higher priority. so k1 < k2
 		return -1
-	case s1.Transaction.Fee < s2.Transaction.Fee:
+	case k1.fee < k2.fee:
 		return 1
-	case s1.Signature < s2.Signature:
-		// s1 is higher priority
+	case k1.signature < k2.signature:
+		// k1 is higher priority
 		return -1
-	case s1.Signature > s2.Signature:
+	case k1.signature > k2.signature:
 		return 1
 	default:
 		return 0
 	}
 }
 
+// compareFeesPerByte puts the higher fee per byte first, breaking ties
+// like compareFees.
+func compareFeesPerByte(k1, k2 priorityKey) int {
+	switch {
+	case k1.perByte > k2.perByte:
+		return -1
+	case k1.perByte < k2.perByte:
+		return 1
+	default:
+		return compareFees(k1, k2)
+	}
+}
+
+// HighestPriorityFirst is a comparator in the emirpasic/gods comparator style.
+// Negative return indicates a < b
+// Positive return indicates a > b
+// Comparison indicates overall "priority" putting the highest priority first.
+// This means that when a has a higher fee than b, a < b.
+func HighestPriorityFirst(a, b interface{}) int {
+	s1 := a.(*SignedTransaction)
+	s2 := b.(*SignedTransaction)
+	return compareFees(
+		priorityKey{fee: s1.Fee, signature: s1.Signature},
+		priorityKey{fee: s2.Fee, signature: s2.Signature})
+}
+
+// HighestFeePerByteFirst is like HighestPriorityFirst, but it compares
+// Priority before comparing fees.
+func HighestFeePerByteFirst(a, b interface{}) int {
+	s1 := a.(*SignedTransaction)
+	s2 := b.(*SignedTransaction)
+	return compareFeesPerByte(s1.priorityKey(), s2.priorityKey())
+}
+
 func makeTestTransaction(n int) *SignedTransaction {
 	kp := util.NewKeyPairFromSecretPhrase(fmt.Sprintf("blorp %d", n))
 	dest := util.NewKeyPairFromSecretPhrase("destination")
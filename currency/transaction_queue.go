@@ -1,7 +1,11 @@
 package currency
 
 import (
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/emirpasic/gods/sets/treeset"
 
@@ -9,9 +13,33 @@ import (
 	"coinkit/util"
 )
 
-// QueueLimit defines how many items will be held in the queue at a time
+// QueueLimit defines how many items will be held in the queue at a time,
+// unless a different limit is provided
 const QueueLimit = 1000
 
+// FeeFloorPercent is how full, as a percentage of its limit, the queue has
+// to be before it starts rejecting transactions below its fee floor.
+const FeeFloorPercent = 80
+
+// QueueOrder selects how a TransactionQueue prioritizes transactions.
+type QueueOrder int
+
+const (
+	// FeePerByteOrder puts the highest Priority, the fee per byte, first.
+	FeePerByteOrder QueueOrder = iota
+
+	// FeeOrder puts the highest raw fee first, like HighestPriorityFirst.
+	FeeOrder
+)
+
+// Chunks always put their transactions in HighestFeePerByteFirst order,
+// whatever the queue's QueueOrder is. The chunk order is part of the
+// protocol: nodes have to agree on it to combine the same candidate chunks
+// into the same chunk. QueueOrder only affects eviction and Top.
+func chunkOrder(a, b interface{}) int {
+	return HighestFeePerByteFirst(a, b)
+}
+
 // TransactionQueue keeps the transactions that are pending but have neither
 // been rejected nor confirmed.
 // TransactionQueue is not threadsafe.
@@ -22,6 +50,16 @@ type TransactionQueue struct {
 	// The pool of pending transactions.
 	set *treeset.Set
 
+	// The same pending transactions, indexed by hash
+	index map[string]*SignedTransaction
+
+	// How many transactions the pool can hold.
+	// When it is full, the lowest-priority transaction is evicted.
+	limit int
+
+	// How the pool is prioritized
+	order QueueOrder
+
 	// The ledger chunks that are being considered
 	// They are indexed by their hash
 	chunks map[consensus.SlotValue]*LedgerChunk
@@ -43,12 +81,49 @@ type TransactionQueue struct {
 
 	// A count of the number of transactions this queue has finalized
 	finalized int
+
+	// Counters for monitoring. Size is filled in by Stats
+	stats QueueStats
+}
+
+// QueueStats counts what has happened to a TransactionQueue.
+type QueueStats struct {
+	// Transactions that were put in the queue
+	Adds int
+
+	// Calls to Add that did not put a transaction in the queue
+	Rejects int
+
+	// Transactions that were pushed out because the queue was full
+	Evictions int
+
+	// Transactions that were taken out with Remove
+	Removes int
+
+	// How many transactions are in the queue now
+	Size int
+}
+
+func (s QueueStats) String() string {
+	return fmt.Sprintf("%d adds, %d rejects, %d evictions, %d removes, size %d",
+		s.Adds, s.Rejects, s.Evictions, s.Removes, s.Size)
 }
 
 func NewTransactionQueue(publicKey util.PublicKey) *TransactionQueue {
-	return &TransactionQueue{
+	return NewTransactionQueueWithLimit(publicKey, QueueLimit)
+}
+
+func NewTransactionQueueWithLimit(publicKey util.PublicKey, limit int) *TransactionQueue {
+	return NewTransactionQueueWithOrder(publicKey, limit, FeePerByteOrder)
+}
+
+func NewTransactionQueueWithOrder(
+	publicKey util.PublicKey, limit int, order QueueOrder) *TransactionQueue {
+	q := &TransactionQueue{
 		publicKey: publicKey,
-		set:       treeset.NewWith(HighestPriorityFirst),
+		index:     make(map[string]*SignedTransaction),
+		limit:     limit,
+		order:     order,
 		chunks:    make(map[consensus.SlotValue]*LedgerChunk),
 		oldChunks: make(map[int]*LedgerChunk),
 		accounts:  NewAccountMap(),
@@ -56,6 +131,23 @@ func NewTransactionQueue(publicKey util.PublicKey) *TransactionQueue {
 		slot:      1,
 		finalized: 0,
 	}
+	q.set = treeset.NewWith(q.compare)
+	return q
+}
+
+func (q *TransactionQueue) compareKeys(k1, k2 priorityKey) int {
+	if q.order == FeeOrder {
+		return compareFees(k1, k2)
+	}
+	return compareFeesPerByte(k1, k2)
+}
+
+// compare is a comparator for the queue's priority order, in the same style
+// as HighestPriorityFirst.
+func (q *TransactionQueue) compare(a, b interface{}) int {
+	s1 := a.(*SignedTransaction)
+	s2 := b.(*SignedTransaction)
+	return q.compareKeys(s1.priorityKey(), s2.priorityKey())
 }
 
 // Returns the top n items in the queue
@@ -71,12 +163,68 @@ func (q *TransactionQueue) Top(n int) []*SignedTransaction {
 	return answer
 }
 
+// TopAfter pages through the queue in priority order.
+// It returns up to n transactions that come after the cursor, along with a
+// cursor for the following page.
+// An empty cursor starts from the top. Other cursors should come from a
+// previous TopAfter; they mark a position in the priority order rather than
+// a particular transaction, so they stay valid as the queue changes.
+func (q *TransactionQueue) TopAfter(cursor string, n int) ([]*SignedTransaction, string) {
+	var after *priorityKey
+	if cursor != "" {
+		parts := strings.SplitN(cursor, ":", 3)
+		if len(parts) != 3 {
+			return []*SignedTransaction{}, cursor
+		}
+		perByte, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return []*SignedTransaction{}, cursor
+		}
+		fee, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return []*SignedTransaction{}, cursor
+		}
+		after = &priorityKey{
+			perByte:   perByte,
+			fee:       fee,
+			signature: parts[2],
+		}
+	}
+
+	answer := []*SignedTransaction{}
+	for _, item := range q.set.Values() {
+		if len(answer) == n {
+			break
+		}
+		t := item.(*SignedTransaction)
+		if after != nil && q.compareKeys(t.priorityKey(), *after) <= 0 {
+			continue
+		}
+		answer = append(answer, t)
+	}
+	if len(answer) == 0 {
+		return answer, cursor
+	}
+	last := answer[len(answer)-1]
+	return answer, fmt.Sprintf("%s:%d:%s",
+		strconv.FormatFloat(last.Priority(), 'g', -1, 64), last.Fee, last.Signature)
+}
+
 // Remove removes a transaction from the queue
 func (q *TransactionQueue) Remove(t *SignedTransaction) {
-	if t == nil {
-		return
+	if q.remove(t) {
+		q.stats.Removes++
+	}
+}
+
+// remove returns whether t was in the queue
+func (q *TransactionQueue) remove(t *SignedTransaction) bool {
+	if t == nil || !q.Contains(t) {
+		return false
 	}
 	q.set.Remove(t)
+	delete(q.index, t.Hash())
+	return true
 }
 
 func (q *TransactionQueue) Logf(format string, a ...interface{}) {
@@ -90,28 +238,83 @@ func (q *TransactionQueue) Logf(format string, a ...interface{}) {
 // Returns whether any changes were made.
 func (q *TransactionQueue) Add(t *SignedTransaction) bool {
 	if !q.Validate(t) || q.Contains(t) {
+		q.stats.Rejects++
+		return false
+	}
+	if _, ok := q.index[t.Hash()]; ok {
+		// The same transaction, with its signature encoded differently
+		q.stats.Rejects++
+		return false
+	}
+	if t.Expired(q.slot) {
+		q.Logf("rejecting a transaction that expired after slot %d", t.ValidUntilSlot)
+		q.stats.Rejects++
 		return false
 	}
+	if worst := q.floor(); worst != nil && q.compare(t, worst) > 0 {
+		q.Logf("rejecting a transaction below the floor of %s", worst.Transaction)
+		q.stats.Rejects++
+		return false
+	}
+
+	// Cache the size now, since the treeset compares with it a lot
+	t.encodedSize()
 
 	q.Logf("saw a new transaction: %s", t.Transaction)
 	q.set.Add(t)
+	q.index[t.Hash()] = t
+	q.stats.Adds++
 
-	if q.set.Size() > QueueLimit {
+	if q.set.Size() > q.limit {
 		it := q.set.Iterator()
 		if !it.Last() {
 			log.Fatal("logical failure with treeset")
 		}
 		worst := it.Value()
-		q.set.Remove(worst)
+		q.remove(worst.(*SignedTransaction))
+		q.stats.Evictions++
 	}
 
 	return q.Contains(t)
 }
 
+// floor returns the lowest priority pending transaction once the queue is
+// FeeFloorPercent full, and nil before then.
+// Add rejects transactions that the queue's order puts after the floor, since
+// they would be the next to be evicted anyway.
+func (q *TransactionQueue) floor() *SignedTransaction {
+	if q.set.Size()*100 < q.limit*FeeFloorPercent {
+		return nil
+	}
+	it := q.set.Iterator()
+	if !it.Last() {
+		return nil
+	}
+	return it.Value().(*SignedTransaction)
+}
+
+// MinFee is the fee of the floor transaction, or zero when there is no floor.
+// It rises as the queue fills up with better-paying transactions.
+// With FeePerByteOrder, a transaction needs a better fee per byte than the
+// floor to get in, so a small transaction can get in with less than MinFee.
+func (q *TransactionQueue) MinFee() uint64 {
+	worst := q.floor()
+	if worst == nil {
+		return 0
+	}
+	return worst.Fee
+}
+
 func (q *TransactionQueue) Contains(t *SignedTransaction) bool {
 	return q.set.Contains(t)
 }
 
+// Get looks up a pending transaction by its hash
+func (q *TransactionQueue) Get(hash string) (*SignedTransaction, bool) {
+	t, ok := q.index[hash]
+	return t, ok
+}
+
 func (q *TransactionQueue) Transactions() []*SignedTransaction {
 	answer := []*SignedTransaction{}
 	for _, t := range q.set.Values() {
@@ -120,6 +323,18 @@ func (q *TransactionQueue) Transactions() []*SignedTransaction {
 	return answer
 }
 
+// chunkOrderTransactions returns the pending transactions sorted in
+// chunkOrder.
+func (q *TransactionQueue) chunkOrderTransactions() []*SignedTransaction {
+	ts := q.Transactions()
+	if q.order != FeePerByteOrder {
+		sort.Slice(ts, func(i, j int) bool {
+			return chunkOrder(ts[i], ts[j]) < 0
+		})
+	}
+	return ts
+}
+
 // SharingMessage returns the pending transactions we want to share with other nodes.
 func (q *TransactionQueue) SharingMessage() *TransactionMessage {
 	ts := q.Transactions()
@@ -142,6 +357,12 @@ func (q *TransactionQueue) SetBalance(owner string, balance uint64) {
 	q.accounts.SetBalance(owner, balance)
 }
 
+// OldChunk returns the chunk that was finalized for the given slot, or nil
+// if we don't have one.
+func (q *TransactionQueue) OldChunk(slot int) *LedgerChunk {
+	return q.oldChunks[slot]
+}
+
 func (q *TransactionQueue) OldChunkMessage(slot int) *TransactionMessage {
 	chunk, ok := q.oldChunks[slot]
 	if !ok {
@@ -185,7 +406,7 @@ func (q *TransactionQueue) HandleTransactionMessage(m *TransactionMessage) bool
 			if _, ok := q.chunks[key]; ok {
 				continue
 			}
-			if !q.accounts.ValidateChunk(chunk) {
+			if !q.validateChunk(chunk) {
 				continue
 			}
 			if chunk.Hash() != key {
@@ -199,6 +420,12 @@ func (q *TransactionQueue) HandleTransactionMessage(m *TransactionMessage) bool
 	return updated
 }
 
+// validateChunk returns whether chunk could be used for the slot we are
+// working on.
+func (q *TransactionQueue) validateChunk(chunk *LedgerChunk) bool {
+	return chunk.CheckExpiry(q.slot) == nil && q.accounts.ValidateChunk(chunk)
+}
+
 func (q *TransactionQueue) Size() int {
 	return q.set.Size()
 }
@@ -216,8 +443,25 @@ func (q *TransactionQueue) Revalidate() {
 	}
 }
 
+// Expire removes the transactions that can no longer go in currentSlot or
+// any later slot, and returns how many it removed.
+func (q *TransactionQueue) Expire(currentSlot int) int {
+	dropped := 0
+	for _, t := range q.Transactions() {
+		if t.Expired(currentSlot) {
+			q.Remove(t)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		q.Logf("expired %d transactions", dropped)
+	}
+	return dropped
+}
+
 // NewLedgerChunk creates a ledger chunk from a list of signed transactions.
-// The list should already be sorted and deduped and the signed transactions
+// The list should already be sorted in chunkOrder and deduped
+// and the signed transactions
 // should be verified.
 // Returns "", nil if there were no valid transactions.
 // This adds a cache entry to q.chunks
@@ -228,15 +472,16 @@ func (q *TransactionQueue) NewChunk(
 	validator := q.accounts.CowCopy()
 	state := make(map[string]*Account)
 	for _, t := range ts {
-		if last != nil && HighestPriorityFirst(last, t) >= 0 {
+		if last != nil && chunkOrder(last, t) >= 0 {
 			panic("NewLedgerChunk called on non-sorted list")
 		}
 		last = t
-		if validator.Process(t.Transaction) {
+		if !t.Expired(q.slot) && validator.Process(t.Transaction) {
 			transactions = append(transactions, t)
 		}
-		state[t.From] = validator.Get(t.From)
-		state[t.To] = validator.Get(t.To)
+		// Copy, so the chunk never aliases accounts in the live ledger
+		state[t.From] = validator.Get(t.From).Copy()
+		state[t.To] = validator.Get(t.To).Copy()
 		if len(transactions) == MaxChunkSize {
 			break
 		}
@@ -257,8 +502,46 @@ func (q *TransactionQueue) NewChunk(
 	return key, chunk
 }
 
+// BuildChunk makes a chunk out of the top transactions in the queue, applied
+// in chunkOrder on top of accounts. Transactions that can't be applied,
+// such as ones their sender can't afford, are skipped.
+// At most limit transactions are included, and never more than MaxChunkSize.
+// accounts is not modified. Returns nil if no transactions could be applied.
+func (q *TransactionQueue) BuildChunk(
+	accounts map[string]*Account, limit int) *LedgerChunk {
+	if limit > MaxChunkSize {
+		limit = MaxChunkSize
+	}
+	cache := NewAccountCache(accounts)
+	transactions := []*SignedTransaction{}
+	state := make(map[string]*Account)
+	for _, t := range q.chunkOrderTransactions() {
+		if len(transactions) >= limit {
+			break
+		}
+		if t.Expired(q.slot) || !cache.Process(t.Transaction) {
+			continue
+		}
+		transactions = append(transactions, t)
+		state[t.From] = cache.Get(t.From).Copy()
+		state[t.To] = cache.Get(t.To).Copy()
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+	return &LedgerChunk{
+		Transactions: transactions,
+		State:        state,
+	}
+}
+
+// Combine merges the chunks in list into one chunk.
+// If there are too many transactions to fit, it keeps the ones that come
+// first in chunkOrder, so the highest fee per byte transactions survive.
+// chunkOrder is total and doesn't depend on the queue's settings, so every
+// node combines the same list the same way.
 func (q *TransactionQueue) Combine(list []consensus.SlotValue) consensus.SlotValue {
-	set := treeset.NewWith(HighestPriorityFirst)
+	set := treeset.NewWith(chunkOrder)
 	for _, v := range list {
 		chunk := q.chunks[v]
 		if chunk == nil {
@@ -290,7 +573,7 @@ func (q *TransactionQueue) Finalize(v consensus.SlotValue) {
 		panic("We are finalizing a chunk but we don't know its data.")
 	}
 
-	if !q.accounts.ValidateChunk(chunk) {
+	if !q.validateChunk(chunk) {
 		panic("We could not validate a finalized chunk.")
 	}
 
@@ -303,6 +586,7 @@ func (q *TransactionQueue) Finalize(v consensus.SlotValue) {
 	q.last = v
 	q.chunks = make(map[consensus.SlotValue]*LedgerChunk)
 	q.slot += 1
+	q.Expire(q.slot)
 	q.Revalidate()
 }
 
@@ -312,7 +596,7 @@ func (q *TransactionQueue) Last() consensus.SlotValue {
 
 // SuggestValue returns a chunk that is keyed by its hash
 func (q *TransactionQueue) SuggestValue() (consensus.SlotValue, bool) {
-	key, chunk := q.NewChunk(q.Transactions())
+	key, chunk := q.NewChunk(q.chunkOrderTransactions())
 	if chunk == nil {
 		q.Logf("has no suggestion")
 		return consensus.SlotValue(""), false
@@ -326,8 +610,16 @@ func (q *TransactionQueue) ValidateValue(v consensus.SlotValue) bool {
 	return ok
 }
 
-func (q *TransactionQueue) Stats() {
+// Stats returns the queue's counters.
+func (q *TransactionQueue) Stats() QueueStats {
+	stats := q.stats
+	stats.Size = q.set.Size()
+	return stats
+}
+
+func (q *TransactionQueue) LogStats() {
 	q.Logf("%d transactions finalized", q.finalized)
+	q.Logf("%s", q.Stats())
 }
 
 func (q *TransactionQueue) Log() {
@@ -1,14 +1,18 @@
 package currency
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 
+	"coinkit/consensus"
 	"coinkit/util"
 )
 
 func TestFullQueue(t *testing.T) {
 	kp := util.NewKeyPair()
-	q := NewTransactionQueue(kp.PublicKey())
+	q := NewTransactionQueueWithOrder(kp.PublicKey(), QueueLimit, FeeOrder)
 	for i := 1; i <= QueueLimit+10; i++ {
 		t := makeTestTransaction(i)
 		q.accounts.SetBalance(t.Transaction.From, 10*t.Transaction.Amount)
@@ -31,16 +35,637 @@ func TestFullQueue(t *testing.T) {
 	}
 }
 
+func TestQueueFeeFloor(t *testing.T) {
+	kp := util.NewKeyPair()
+	q := NewTransactionQueueWithOrder(kp.PublicKey(), 10, FeeOrder)
+	add := func(n int) bool {
+		tr := makeTestTransaction(n)
+		q.accounts.SetBalance(tr.Transaction.From, 10*tr.Transaction.Amount)
+		return q.Add(tr)
+	}
+
+	// Below 80% full, any fee is fine
+	for i := 5; i <= 11; i++ {
+		add(i)
+	}
+	if q.MinFee() != 0 {
+		t.Fatalf("a queue with %d of 10 should have no floor", q.Size())
+	}
+	add(12)
+	if q.MinFee() != 5 {
+		t.Fatalf("expected a floor of 5, got %d", q.MinFee())
+	}
+	if add(3) {
+		t.Fatal("a transaction below the floor should be rejected")
+	}
+
+	// Filling up with better transactions evicts the worst ones
+	for i := 20; i <= 25; i++ {
+		add(i)
+	}
+	if q.Size() != 10 {
+		t.Fatalf("q.Size() was %d", q.Size())
+	}
+	if q.MinFee() != 9 {
+		t.Fatalf("expected the floor to rise to 9, got %d", q.MinFee())
+	}
+	if add(8) {
+		t.Fatal("a transaction below the risen floor should be rejected")
+	}
+	if !add(15) {
+		t.Fatal("a transaction above the floor should be accepted")
+	}
+}
+
+func TestQueueFeeFloorPerByte(t *testing.T) {
+	kp := util.NewKeyPair()
+	q := NewTransactionQueueWithLimit(kp.PublicKey(), 10)
+	add := func(name string, amount uint64, fee uint64, until int) *SignedTransaction {
+		from := util.NewKeyPairFromSecretPhrase(name)
+		tr := (&Transaction{
+			From:           from.PublicKey().String(),
+			Sequence:       1,
+			To:             kp.PublicKey().String(),
+			Amount:         amount,
+			Fee:            fee,
+			ValidUntilSlot: until,
+		}).SignWith(from)
+		q.accounts.SetBalance(tr.From, amount+fee)
+		q.Add(tr)
+		return tr
+	}
+
+	// Fill the queue past the floor with large transactions
+	for i := 0; i < 8; i++ {
+		add(fmt.Sprintf("large %d", i), 1000000000000000000, uint64(100+i), 1000000000000000)
+	}
+	worst := q.floor()
+	if worst == nil || worst.Fee != 100 {
+		t.Fatal("expected the floor to be the large transaction with fee 100")
+	}
+
+	// A small transaction with a lower fee but a higher fee per byte gets in
+	small := add("small", 1, 99, 0)
+	if small.Priority() <= worst.Priority() {
+		t.Fatal("the small transaction should have a higher fee per byte")
+	}
+	if !q.Contains(small) {
+		t.Fatal("a transaction with a better fee per byte should be accepted")
+	}
+
+	// A larger transaction with the floor's fee, but a lower fee per byte,
+	// does not
+	larger := add("larger", 1000000000000000000, 100, 1000000000000000000)
+	if larger.Priority() >= q.floor().Priority() {
+		t.Fatal("the larger transaction should have a lower fee per byte")
+	}
+	if q.Contains(larger) {
+		t.Fatal("a transaction with a worse fee per byte should be rejected")
+	}
+}
+
+func TestQueueExpire(t *testing.T) {
+	kp := util.NewKeyPair()
+	q := NewTransactionQueue(kp.PublicKey())
+	expiries := []int{0, 3, 5, 5, 8}
+	for i, until := range expiries {
+		from := util.NewKeyPairFromSecretPhrase(fmt.Sprintf("expiring %d", i))
+		tr := &Transaction{
+			From:           from.PublicKey().String(),
+			Sequence:       1,
+			To:             kp.PublicKey().String(),
+			Amount:         1,
+			Fee:            1,
+			ValidUntilSlot: until,
+		}
+		q.accounts.SetBalance(tr.From, 10)
+		if !q.Add(tr.SignWith(from)) {
+			t.Fatalf("could not add transaction %d", i)
+		}
+	}
+
+	if q.Expire(3) != 0 {
+		t.Fatal("nothing should expire in its last valid slot")
+	}
+	if q.Expire(6) != 3 {
+		t.Fatal("the transactions valid until slots 3 and 5 should expire")
+	}
+	if q.Size() != 2 {
+		t.Fatalf("q.Size() was %d", q.Size())
+	}
+	if q.Expire(1000) != 1 || q.Size() != 1 {
+		t.Fatal("only the transaction with no expiry should remain")
+	}
+	if q.Transactions()[0].ValidUntilSlot != 0 {
+		t.Fatal("the wrong transaction remained")
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	kp := util.NewKeyPair()
+	q := NewTransactionQueueWithOrder(kp.PublicKey(), QueueLimit, FeeOrder)
+	for i := 1; i <= QueueLimit+10; i++ {
+		t := makeTestTransaction(i)
+		q.accounts.SetBalance(t.Transaction.From, 10*t.Transaction.Amount)
+		q.Add(t)
+	}
+	q.Add(nil)
+	q.Add(makeTestTransaction(QueueLimit + 10))
+	q.Remove(makeTestTransaction(QueueLimit + 10))
+	q.Remove(makeTestTransaction(1))
+
+	stats := q.Stats()
+	expected := QueueStats{
+		Adds:      QueueLimit + 10,
+		Rejects:   2,
+		Evictions: 10,
+		Removes:   1,
+		Size:      QueueLimit - 1,
+	}
+	if stats != expected {
+		t.Fatalf("expected stats %s but got %s", expected, stats)
+	}
+}
+
+func TestQueueRejectsReencodedDuplicates(t *testing.T) {
+	q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+	st := makeTestTransaction(1)
+	q.accounts.SetBalance(st.From, 10)
+	if !q.Add(st) {
+		t.Fatal("could not add the transaction")
+	}
+
+	legacy := &SignedTransaction{
+		Transaction: st.Transaction,
+		Signature:   st.Signature[strings.Index(st.Signature, ".")+1:],
+	}
+	if !legacy.Verify() {
+		t.Fatal("the untagged signature should still verify")
+	}
+	if q.Add(legacy) {
+		t.Fatal("a re-encoded copy of a queued transaction should be rejected")
+	}
+
+	// Decoding canonicalizes the signature
+	m := util.EncodeThenDecode(NewTransactionMessage(legacy)).(*TransactionMessage)
+	if m.Transactions[0].Signature != st.Signature {
+		t.Fatal("decoding should restore the tagged signature")
+	}
+
+	q.Remove(st)
+	if q.Size() != 0 || len(q.index) != 0 {
+		t.Fatal("removing the transaction should leave nothing behind")
+	}
+}
+
+func TestQueueRejectsExpired(t *testing.T) {
+	kp := util.NewKeyPair()
+	q := NewTransactionQueue(kp.PublicKey())
+	q.slot = 5
+	from := util.NewKeyPairFromSecretPhrase("expired")
+	q.accounts.SetBalance(from.PublicKey().String(), 10)
+	expired := (&Transaction{
+		From:           from.PublicKey().String(),
+		Sequence:       1,
+		To:             kp.PublicKey().String(),
+		Amount:         1,
+		Fee:            1,
+		ValidUntilSlot: 4,
+	}).SignWith(from)
+	if q.Add(expired) {
+		t.Fatal("a transaction that has already expired should be rejected")
+	}
+
+	// A chunk with the expired transaction can't be used for this slot
+	chunk := &LedgerChunk{
+		Transactions: []*SignedTransaction{expired},
+		State: map[string]*Account{
+			expired.From: &Account{Sequence: 1, Balance: 8},
+			expired.To:   &Account{Sequence: 0, Balance: 1},
+		},
+	}
+	if chunk.CheckExpiry(4) != nil {
+		t.Fatal("the chunk should be fine for slot 4")
+	}
+	if chunk.CheckExpiry(5) == nil {
+		t.Fatal("the chunk should be expired for slot 5")
+	}
+	m := &TransactionMessage{
+		Transactions: []*SignedTransaction{},
+		Chunks:       map[consensus.SlotValue]*LedgerChunk{chunk.Hash(): chunk},
+	}
+	if q.HandleTransactionMessage(m) || q.ValidateValue(chunk.Hash()) {
+		t.Fatal("a chunk with an expired transaction should be ignored")
+	}
+	q.slot = 4
+	if !q.HandleTransactionMessage(m) {
+		t.Fatal("the chunk should be accepted for slot 4")
+	}
+}
+
 func TestSharingMessage(t *testing.T) {
 	kp := util.NewKeyPair()
 	q := NewTransactionQueue(kp.PublicKey())
 	if q.SharingMessage() != nil {
 		t.Fatal("there should be no sharing message with an empty queue")
 	}
-	tr := makeTestTransaction(0)
+	tr := makeTestTransaction(1)
 	q.accounts.SetBalance(tr.Transaction.From, 10*tr.Transaction.Amount)
 	q.Add(tr)
 	if q.SharingMessage() == nil {
 		t.Fatal("there should be a sharing message after we add one transaction")
 	}
 }
+
+func TestQueueSequenceValidation(t *testing.T) {
+	q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+	kp := util.NewKeyPairFromSecretPhrase("sender")
+	dest := util.NewKeyPairFromSecretPhrase("destination")
+	q.accounts.Set(kp.PublicKey().String(), &Account{Sequence: 5, Balance: 100})
+	send := func(sequence uint32) *SignedTransaction {
+		tr := &Transaction{
+			From:     kp.PublicKey().String(),
+			Sequence: sequence,
+			To:       dest.PublicKey().String(),
+			Amount:   1,
+			Fee:      1,
+		}
+		return tr.SignWith(kp)
+	}
+
+	if q.Add(send(5)) {
+		t.Fatal("a replayed sequence should be rejected")
+	}
+	if q.Add(send(7)) {
+		t.Fatal("a sequence with a gap should be rejected")
+	}
+	if !q.Add(send(6)) {
+		t.Fatal("the next sequence should be accepted")
+	}
+	if q.Size() != 1 {
+		t.Fatalf("expected one transaction in the queue, got %d", q.Size())
+	}
+}
+
+func TestQueueEvictsLowestFee(t *testing.T) {
+	q := NewTransactionQueueWithLimit(util.NewKeyPair().PublicKey(), 3)
+	dest := util.NewKeyPairFromSecretPhrase("destination")
+	for i := 1; i <= 5; i++ {
+		kp := util.NewKeyPairFromSecretPhrase(fmt.Sprintf("fee payer %d", i))
+		tr := &Transaction{
+			From:     kp.PublicKey().String(),
+			Sequence: 1,
+			To:       dest.PublicKey().String(),
+			Amount:   uint64(100 - i),
+			Fee:      uint64(i),
+		}
+		q.SetBalance(tr.From, 1000)
+		q.Add(tr.SignWith(kp))
+	}
+	if q.Size() != 3 {
+		t.Fatalf("q.Size() was %d", q.Size())
+	}
+	for i, tr := range q.Top(3) {
+		if tr.Fee != uint64(5-i) {
+			t.Fatalf("expected the highest fees to be kept, got %s", tr.Transaction)
+		}
+	}
+}
+
+func TestQueueLookup(t *testing.T) {
+	q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+	t1 := makeTestTransaction(1)
+	t2 := makeTestTransaction(2)
+	q.SetBalance(t1.From, 100)
+	q.SetBalance(t2.From, 100)
+	q.Add(t1)
+	q.Add(t2)
+	if !q.Contains(t1) || !q.Contains(makeTestTransaction(1)) {
+		t.Fatal("the queue should contain t1")
+	}
+	found, ok := q.Get(t1.Hash())
+	if !ok || found != t1 {
+		t.Fatal("t1 should be found by hash")
+	}
+
+	q.Remove(makeTestTransaction(1))
+	if q.Contains(t1) {
+		t.Fatal("t1 should have been removed")
+	}
+	if _, ok := q.Get(t1.Hash()); ok {
+		t.Fatal("t1 should not be found after removal")
+	}
+	if _, ok := q.Get(t2.Hash()); !ok {
+		t.Fatal("t2 should still be found")
+	}
+}
+
+func TestQueueRemovalKeepsOrder(t *testing.T) {
+	q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+	for i := 1; i <= 20; i++ {
+		tr := makeTestTransaction(i)
+		q.SetBalance(tr.From, 100)
+		q.Add(tr)
+	}
+	for i := 1; i <= 20; i += 3 {
+		q.Remove(makeTestTransaction(i))
+	}
+	top := q.Top(q.Size())
+	for i := 1; i < len(top); i++ {
+		if q.compare(top[i-1], top[i]) >= 0 {
+			t.Fatalf("top is out of order at %d", i)
+		}
+		if top[i].Amount%3 == 1 {
+			t.Fatalf("transaction %d should have been removed", top[i].Amount)
+		}
+	}
+	if len(top) != 13 {
+		t.Fatalf("expected 13 transactions left but got %d", len(top))
+	}
+}
+
+func BenchmarkQueueRemove(b *testing.B) {
+	ts := []*SignedTransaction{}
+	for i := 1; i <= QueueLimit; i++ {
+		ts = append(ts, makeTestTransaction(i))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+		for _, tr := range ts {
+			q.SetBalance(tr.From, 10*tr.Amount)
+			q.Add(tr)
+		}
+		b.StartTimer()
+		for _, tr := range ts {
+			q.Remove(tr)
+		}
+	}
+}
+
+func TestQueuePaging(t *testing.T) {
+	q := NewTransactionQueueWithLimit(util.NewKeyPair().PublicKey(), 10)
+	for i := 11; i <= 20; i++ {
+		tr := makeTestTransaction(i)
+		q.SetBalance(tr.From, 100)
+		q.Add(tr)
+	}
+	page1, cursor := q.TopAfter("", 6)
+	if len(page1) != 6 {
+		t.Fatalf("expected a full first page but got %d", len(page1))
+	}
+
+	// Including the first page and adding lower-priority transactions
+	// should not disturb the cursor
+	for _, tr := range page1 {
+		q.Remove(tr)
+	}
+	for i := 1; i <= 3; i++ {
+		tr := makeTestTransaction(i)
+		q.SetBalance(tr.From, 100)
+		q.Add(tr)
+	}
+
+	page2, _ := q.TopAfter(cursor, 4)
+	if len(page2) != 4 {
+		t.Fatalf("expected a full second page but got %d", len(page2))
+	}
+	all := append(page1, page2...)
+	for i, tr := range all {
+		if tr.Amount != uint64(20-i) {
+			t.Fatalf("expected amount %d at %d but got %d", 20-i, i, tr.Amount)
+		}
+	}
+
+	page3, cursor3 := q.TopAfter(cursor, 100)
+	if len(page3) != 7 || page3[6].Amount != 1 {
+		t.Fatalf("bad final page: %s", StringifyTransactions(page3))
+	}
+	if rest, _ := q.TopAfter(cursor3, 100); len(rest) != 0 {
+		t.Fatal("there should be nothing after the last page")
+	}
+}
+
+func TestCombineTruncatesCanonically(t *testing.T) {
+	makeGroup := func(start, end int) []*SignedTransaction {
+		group := []*SignedTransaction{}
+		for i := start; i <= end; i++ {
+			group = append(group, makeTestTransaction(i))
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return HighestFeePerByteFirst(group[i], group[j]) < 0
+		})
+		return group
+	}
+	groups := [][]*SignedTransaction{
+		makeGroup(1, MaxChunkSize-20),
+		makeGroup(MaxChunkSize-40, MaxChunkSize+40),
+	}
+
+	queues := []*TransactionQueue{}
+	for i := 0; i < 2; i++ {
+		q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+		for j := 1; j <= MaxChunkSize+40; j++ {
+			st := makeTestTransaction(j)
+			q.accounts.SetBalance(st.From, 10*st.Amount)
+		}
+		queues = append(queues, q)
+	}
+
+	// Each node learns of the chunks in a different order
+	values := [][]consensus.SlotValue{}
+	for i, q := range queues {
+		list := []consensus.SlotValue{}
+		for j := range groups {
+			v, chunk := q.NewChunk(groups[(i+j)%len(groups)])
+			if chunk == nil {
+				t.Fatal("expected a chunk")
+			}
+			list = append(list, v)
+		}
+		values = append(values, list)
+	}
+
+	v0 := queues[0].Combine(values[0])
+	v1 := queues[1].Combine(values[1])
+	if v0 != v1 {
+		t.Fatal("every node should combine to the same value")
+	}
+	chunk := queues[0].chunks[v0]
+	if len(chunk.Transactions) != MaxChunkSize {
+		t.Fatalf("expected %d transactions but got %d",
+			MaxChunkSize, len(chunk.Transactions))
+	}
+	if chunk.Transactions[0].Amount != MaxChunkSize+40 {
+		t.Fatal("combining should keep the highest priority transactions")
+	}
+}
+
+func TestCombineKeepsHighPriorityTransactions(t *testing.T) {
+	q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+	low := []*SignedTransaction{}
+	for i := 1; i <= MaxChunkSize; i++ {
+		st := makeTestTransaction(i)
+		q.accounts.SetBalance(st.From, 10*st.Amount)
+		low = append(low, st)
+	}
+	sort.Slice(low, func(i, j int) bool {
+		return q.compare(low[i], low[j]) < 0
+	})
+	kp := util.NewKeyPairFromSecretPhrase("important")
+	important := (&Transaction{
+		From:     kp.PublicKey().String(),
+		Sequence: 1,
+		To:       low[0].To,
+		Amount:   1,
+		Fee:      100000,
+	}).SignWith(kp)
+	q.accounts.SetBalance(important.From, important.Fee+1)
+
+	v1, _ := q.NewChunk(low)
+	v2, _ := q.NewChunk([]*SignedTransaction{important})
+	chunk := q.chunks[q.Combine([]consensus.SlotValue{v1, v2})]
+	if len(chunk.Transactions) != MaxChunkSize {
+		t.Fatalf("expected %d transactions but got %d",
+			MaxChunkSize, len(chunk.Transactions))
+	}
+	if chunk.Transactions[0] != important {
+		t.Fatal("the high priority transaction should survive truncation")
+	}
+	for _, st := range chunk.Transactions {
+		if st == low[len(low)-1] {
+			t.Fatal("the lowest priority transaction should be dropped")
+		}
+	}
+}
+
+func TestCombineIgnoresQueueOrder(t *testing.T) {
+	group := func(start, end int) []*SignedTransaction {
+		ts := []*SignedTransaction{}
+		for i := start; i <= end; i++ {
+			ts = append(ts, makeTestTransaction(i))
+		}
+		sort.Slice(ts, func(i, j int) bool {
+			return HighestFeePerByteFirst(ts[i], ts[j]) < 0
+		})
+		return ts
+	}
+	combined := []consensus.SlotValue{}
+	for _, order := range []QueueOrder{FeePerByteOrder, FeeOrder} {
+		q := NewTransactionQueueWithOrder(util.NewKeyPair().PublicKey(), QueueLimit, order)
+		for i := 1; i <= MaxChunkSize+40; i++ {
+			st := makeTestTransaction(i)
+			q.accounts.SetBalance(st.From, 10*st.Amount)
+		}
+		v1, _ := q.NewChunk(group(1, MaxChunkSize-20))
+		v2, _ := q.NewChunk(group(MaxChunkSize-40, MaxChunkSize+40))
+		combined = append(combined, q.Combine([]consensus.SlotValue{v1, v2}))
+	}
+	if combined[0] != combined[1] {
+		t.Fatal("queues with different orders should combine to the same chunk")
+	}
+}
+
+func TestQueueOrderDoesNotChangeChunks(t *testing.T) {
+	queues := []*TransactionQueue{
+		NewTransactionQueueWithOrder(util.NewKeyPair().PublicKey(), QueueLimit, FeePerByteOrder),
+		NewTransactionQueueWithOrder(util.NewKeyPair().PublicKey(), QueueLimit, FeeOrder),
+	}
+	values := []consensus.SlotValue{}
+	for _, q := range queues {
+		for i := 1; i <= MaxChunkSize+20; i++ {
+			st := makeTestTransaction(i)
+			q.accounts.SetBalance(st.From, 10*st.Amount)
+			q.Add(st)
+		}
+		v, ok := q.SuggestValue()
+		if !ok {
+			t.Fatal("expected a suggestion")
+		}
+		values = append(values, v)
+	}
+	if values[0] != values[1] {
+		t.Fatal("queues with different orders should suggest the same chunk")
+	}
+}
+
+func TestQueueFeePerBytePriority(t *testing.T) {
+	dest := util.NewKeyPairFromSecretPhrase("destination")
+	makeTransaction := func(name string, amount uint64, fee uint64) *SignedTransaction {
+		kp := util.NewKeyPairFromSecretPhrase(name)
+		tr := &Transaction{
+			From:     kp.PublicKey().String(),
+			Sequence: 1,
+			To:       dest.PublicKey().String(),
+			Amount:   amount,
+			Fee:      fee,
+		}
+		return tr.SignWith(kp)
+	}
+
+	// The large amount makes for a longer serialization
+	small := makeTransaction("small", 1, 49)
+	large := makeTransaction("large", OneBillion*OneBillion, 50)
+	if small.Priority() <= large.Priority() {
+		t.Fatalf("small priority %f should beat large priority %f",
+			small.Priority(), large.Priority())
+	}
+
+	cases := []struct {
+		order    QueueOrder
+		expected *SignedTransaction
+	}{
+		{FeePerByteOrder, small},
+		{FeeOrder, large},
+	}
+	for _, c := range cases {
+		q := NewTransactionQueueWithOrder(util.NewKeyPair().PublicKey(), 10, c.order)
+		for _, tr := range []*SignedTransaction{large, small} {
+			q.SetBalance(tr.From, tr.Amount+tr.Fee)
+			q.Add(tr)
+		}
+		top := q.Top(1)
+		if len(top) != 1 || top[0] != c.expected {
+			t.Fatalf("with order %d the top was %s", c.order, StringifyTransactions(top))
+		}
+	}
+}
+
+func TestQueueBuildChunk(t *testing.T) {
+	q := NewTransactionQueue(util.NewKeyPair().PublicKey())
+	accounts := make(map[string]*Account)
+	for i := 1; i <= 3; i++ {
+		tr := makeTestTransaction(i)
+		q.SetBalance(tr.From, 100)
+		q.Add(tr)
+		accounts[tr.From] = &Account{Balance: 100}
+	}
+
+	// The second transaction is unaffordable
+	broke := makeTestTransaction(2)
+	accounts[broke.From] = &Account{Balance: 1}
+
+	chunk := q.BuildChunk(accounts, 10)
+	if chunk == nil || len(chunk.Transactions) != 2 {
+		t.Fatalf("expected a chunk with two transactions: %+v", chunk)
+	}
+	for _, tr := range chunk.Transactions {
+		if tr.From == broke.From {
+			t.Fatal("the unaffordable transaction should be skipped")
+		}
+	}
+	if err := chunk.Validate(accounts); err != nil {
+		t.Fatal(err)
+	}
+	if accounts[makeTestTransaction(3).From].Balance != 100 {
+		t.Fatal("BuildChunk should not modify accounts")
+	}
+
+	if chunk := q.BuildChunk(accounts, 1); len(chunk.Transactions) != 1 {
+		t.Fatal("BuildChunk should respect the limit")
+	}
+	if q.BuildChunk(make(map[string]*Account), 10) != nil {
+		t.Fatal("there should be no chunk when nothing is affordable")
+	}
+}
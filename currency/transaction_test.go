@@ -2,13 +2,14 @@ package currency
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
 
 	"coinkit/util"
 )
 
 func TestTestTransactionVerifies(t *testing.T) {
-	st := makeTestTransaction(0)
+	st := makeTestTransaction(1)
 	if !st.Verify() {
 		t.Fatal("should verify")
 	}
@@ -40,3 +41,94 @@ func TestTransactionVerification(t *testing.T) {
 		t.Fatal("address should be valid to get verified")
 	}
 }
+
+func TestCheckFee(t *testing.T) {
+	cases := []struct {
+		fee            uint64
+		balance        uint64
+		requireMinimum bool
+		ok             bool
+	}{
+		{5, 10, true, true},
+		{10, 10, true, true},
+		{11, 10, true, false},
+		{11, 10, false, false},
+		{0, 10, true, false},
+		{0, 10, false, true},
+		{0, 0, false, true},
+	}
+	for _, c := range cases {
+		tr := &Transaction{Amount: 1, Fee: c.fee}
+		account := &Account{Balance: c.balance}
+		err := CheckFee(tr, account, c.requireMinimum)
+		if (err == nil) != c.ok {
+			t.Fatalf("fee %d balance %d requireMinimum %v: got error %v",
+				c.fee, c.balance, c.requireMinimum, err)
+		}
+	}
+	if CheckFee(&Transaction{Fee: 1}, nil, false) == nil {
+		t.Fatal("a missing account cannot pay a fee")
+	}
+}
+
+func TestTransactionVerificationFailures(t *testing.T) {
+	kp1 := util.NewKeyPairFromSecretPhrase("bloop1")
+	kp2 := util.NewKeyPairFromSecretPhrase("bloop2")
+	makeTransaction := func(amount uint64, fee uint64) *Transaction {
+		return &Transaction{
+			From:     kp1.PublicKey().String(),
+			Sequence: 1,
+			To:       kp2.PublicKey().String(),
+			Amount:   amount,
+			Fee:      fee,
+		}
+	}
+
+	var none *SignedTransaction
+	failures := []*SignedTransaction{
+		none,
+		&SignedTransaction{},
+		&SignedTransaction{Transaction: makeTransaction(10, 1), Signature: "garbage"},
+		makeTransaction(0, 1).SignWith(kp1),
+		makeTransaction(math.MaxUint64, 1).SignWith(kp1),
+	}
+	for i, st := range failures {
+		if st.Verify() {
+			t.Fatalf("failure case %d should not verify", i)
+		}
+	}
+
+	if !makeTransaction(math.MaxUint64, 0).SignWith(kp1).Verify() {
+		t.Fatal("a huge amount should be fine as long as it doesn't overflow")
+	}
+}
+
+func TestTransactionHashing(t *testing.T) {
+	kp1 := util.NewKeyPairFromSecretPhrase("bloop1")
+	kp2 := util.NewKeyPairFromSecretPhrase("bloop2")
+	makeTransaction := func(amount uint64) *Transaction {
+		return &Transaction{
+			From:     kp1.PublicKey().String(),
+			Sequence: 1,
+			To:       kp2.PublicKey().String(),
+			Amount:   amount,
+			Fee:      1,
+		}
+	}
+	t1 := makeTransaction(10).SignWith(kp1)
+	t1copy := makeTransaction(10).SignWith(kp1)
+	t2 := makeTransaction(11).SignWith(kp1)
+
+	// The signature is not part of the hash
+	t1sig := &SignedTransaction{Transaction: makeTransaction(10), Signature: "x"}
+
+	if t1.Hash() != t1copy.Hash() {
+		t.Fatal("t1 should equal t1copy")
+	}
+	if t1.Hash() != t1sig.Hash() {
+		t.Fatal("t1 should equal t1sig")
+	}
+	if t1.Hash() == t2.Hash() {
+		t.Fatal("t1 should != t2")
+	}
+}
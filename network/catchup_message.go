@@ -0,0 +1,59 @@
+package network
+
+import (
+	"fmt"
+
+	"coinkit/consensus"
+	"coinkit/currency"
+	"coinkit/util"
+)
+
+// MaxCatchupChunks is the most chunks a single CatchupResponse will contain.
+// A node that is further behind than this has to send several requests.
+const MaxCatchupChunks = 10
+
+// A CatchupRequest is sent by a node that has fallen behind, to ask for the
+// ledger chunks of the slots it is missing.
+type CatchupRequest struct {
+	// The first slot the sender is missing
+	FromSlot int
+}
+
+func (m *CatchupRequest) Slot() int {
+	return m.FromSlot
+}
+
+func (m *CatchupRequest) MessageType() string {
+	return "Q"
+}
+
+func (m *CatchupRequest) String() string {
+	return fmt.Sprintf("catchup-request from=%d", m.FromSlot)
+}
+
+// A CatchupResponse contains the chunks for a run of consecutive externalized
+// slots, starting at I.
+// E holds the matching externalize messages, so that the receiver can check
+// that the network actually agreed on each chunk.
+type CatchupResponse struct {
+	I      int
+	Chunks []*currency.LedgerChunk
+	E      []*consensus.ExternalizeMessage
+}
+
+func (m *CatchupResponse) Slot() int {
+	return m.I
+}
+
+func (m *CatchupResponse) MessageType() string {
+	return "R"
+}
+
+func (m *CatchupResponse) String() string {
+	return fmt.Sprintf("catchup-response i=%d chunks=%d", m.I, len(m.Chunks))
+}
+
+func init() {
+	util.RegisterMessageType(&CatchupRequest{})
+	util.RegisterMessageType(&CatchupResponse{})
+}
@@ -37,7 +37,7 @@ type ServerConfig struct {
 	KeyPair *util.KeyPair
 }
 
-func (nc *NetworkConfig) QuorumSlice() consensus.QuorumSlice {
+func (nc *NetworkConfig) QuorumSlice() (consensus.QuorumSlice, error) {
 	return consensus.MakeQuorumSlice(nc.Members, nc.Threshold)
 }
 
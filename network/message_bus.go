@@ -0,0 +1,168 @@
+package network
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math/rand"
+
+	"coinkit/consensus"
+	"coinkit/currency"
+	"coinkit/util"
+)
+
+// MessageBus connects a set of nodes in memory, for simulating a network.
+// Each tick, every node's outgoing messages are delivered to every other node.
+// MessageBus is not threadsafe.
+type MessageBus struct {
+	nodes []*Node
+
+	// DropRate is the probability that any single message is lost
+	DropRate float64
+
+	// When Reorder is set, the messages in a tick are delivered in random order
+	Reorder bool
+
+	rand *rand.Rand
+}
+
+// NewMessageBus creates a bus whose randomness is determined by seed.
+func NewMessageBus(nodes []*Node, seed int64) *MessageBus {
+	return &MessageBus{
+		nodes: nodes,
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// A delivery is a message in transit from one node to another
+type delivery struct {
+	source  *Node
+	target  *Node
+	message util.Message
+}
+
+// deliver hands a message to its target, encoding and decoding it like the
+// network would. It returns whatever response the target has.
+func (bus *MessageBus) deliver(d delivery) util.Message {
+	if bus.rand.Float64() < bus.DropRate {
+		return nil
+	}
+	m := util.EncodeThenDecode(d.message)
+	return d.target.Handle(d.source.publicKey.String(), m)
+}
+
+// Tick delivers one round of outgoing messages between every pair of nodes.
+// Responses are delivered straight back to the original sender, and can be
+// lost as well.
+func (bus *MessageBus) Tick() {
+	deliveries := []delivery{}
+	for _, source := range bus.nodes {
+		for _, message := range source.OutgoingMessages() {
+			for _, target := range bus.nodes {
+				if source != target {
+					deliveries = append(deliveries, delivery{
+						source:  source,
+						target:  target,
+						message: message,
+					})
+				}
+			}
+		}
+	}
+
+	if bus.Reorder {
+		bus.rand.Shuffle(len(deliveries), func(i, j int) {
+			deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+		})
+	}
+
+	for _, d := range deliveries {
+		response := bus.deliver(d)
+		if response != nil {
+			bus.deliver(delivery{
+				source:  d.target,
+				target:  d.source,
+				message: response,
+			})
+		}
+	}
+}
+
+// seedToInt64 turns a seed string into a seed for math/rand.
+func seedToInt64(seed string) int64 {
+	bytes, err := base64.RawStdEncoding.DecodeString(consensus.HashString(seed))
+	if err != nil {
+		panic(err)
+	}
+	return int64(binary.BigEndian.Uint64(bytes))
+}
+
+// SimulateConsensus runs a simulated network of nodes on a MessageBus until
+// they all externalize a value for the first slot, or maxTicks pass.
+// Message loss, delivery order, and which node hears about the transaction
+// first are all determined by seed, so a failing seed can be replayed.
+// It returns the externalized value, or false if the nodes did not all
+// externalize the same value.
+func SimulateConsensus(
+	seed string, nodes int, dropRate float64, maxTicks int) (consensus.SlotValue, bool) {
+
+	if nodes <= 0 {
+		return consensus.SlotValue(""), false
+	}
+	qs, names := consensus.MakeTestQuorumSlice(nodes)
+	kp := util.NewKeyPairFromSecretPhrase("client " + seed)
+	kp2 := util.NewKeyPairFromSecretPhrase("recipient " + seed)
+	byName := make(map[string]*Node)
+	keys := []string{}
+	list := []*Node{}
+	for _, name := range names {
+		node := NewNode(name, qs)
+		node.queue.SetBalance(kp.PublicKey().String(), 100)
+		byName[name.String()] = node
+		keys = append(keys, name.String())
+		list = append(list, node)
+	}
+
+	// The seed decides which node hears about the transaction first
+	tr := &currency.Transaction{
+		From:     kp.PublicKey().String(),
+		Sequence: 1,
+		To:       kp2.PublicKey().String(),
+		Amount:   1,
+		Fee:      0,
+	}
+	m := currency.NewTransactionMessage(tr.SignWith(kp))
+	leader, err := consensus.SeedLeader(seed, keys)
+	if err != nil {
+		return consensus.SlotValue(""), false
+	}
+	byName[leader].Handle(kp.PublicKey().String(), m)
+
+	bus := NewMessageBus(list, seedToInt64(seed))
+	bus.DropRate = dropRate
+	bus.Reorder = true
+	for i := 0; i < maxTicks; i++ {
+		bus.Tick()
+		done := true
+		for _, node := range list {
+			if node.Slot() < 2 {
+				done = false
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	value, ok := list[0].chain.ExternalizedValue(1)
+	if !ok {
+		return value, false
+	}
+	for _, node := range list {
+		v, ok := node.chain.ExternalizedValue(1)
+		if !ok || v != value {
+			return value, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+
+	"coinkit/consensus"
+	"coinkit/currency"
+	"coinkit/util"
+)
+
+func TestMessageBusWithMessageLoss(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	kp2 := util.NewKeyPairFromSecretPhrase("bob")
+	qs, names := consensus.MakeTestQuorumSlice(4)
+	nodes := []*Node{}
+	for _, name := range names {
+		node := NewNode(name, qs)
+		node.queue.SetBalance(kp.PublicKey().String(), 100)
+		nodes = append(nodes, node)
+	}
+	tr := &currency.Transaction{
+		From:     kp.PublicKey().String(),
+		Sequence: 1,
+		To:       kp2.PublicKey().String(),
+		Amount:   1,
+		Fee:      0,
+	}
+	m := currency.NewTransactionMessage(tr.SignWith(kp))
+	nodes[0].Handle(kp.PublicKey().String(), m)
+
+	bus := NewMessageBus(nodes, 1)
+	bus.DropRate = 0.1
+	bus.Reorder = true
+	for i := 0; i < 100; i++ {
+		bus.Tick()
+		done := true
+		for _, node := range nodes {
+			if node.Slot() < 2 {
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	first, ok := nodes[0].chain.ExternalizedValue(1)
+	if !ok {
+		t.Fatal("the network did not externalize slot 1")
+	}
+	for i, node := range nodes {
+		v, ok := node.chain.ExternalizedValue(1)
+		if !ok {
+			t.Fatalf("nodes[%d] did not externalize slot 1", i)
+		}
+		if v != first {
+			t.Fatalf("nodes[%d] externalized %s instead of %s", i, v, first)
+		}
+	}
+}
+
+func TestSimulateConsensus(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		seed := fmt.Sprintf("seed%d", i)
+		v, ok := SimulateConsensus(seed, 4, 0.1, 100)
+		if !ok {
+			t.Fatalf("no consensus with seed %s", seed)
+		}
+		v2, ok := SimulateConsensus(seed, 4, 0.1, 100)
+		if !ok || v != v2 {
+			t.Fatalf("seed %s did not replay the same way", seed)
+		}
+	}
+	if _, ok := SimulateConsensus("seed", 4, 1.0, 10); ok {
+		t.Fatal("there should be no consensus when every message is lost")
+	}
+	for _, n := range []int{0, -1} {
+		if _, ok := SimulateConsensus("seed", n, 0, 10); ok {
+			t.Fatalf("there should be no consensus with %d nodes", n)
+		}
+	}
+}
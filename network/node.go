@@ -45,6 +45,29 @@ func (node *Node) Handle(sender string, message util.Message) util.Message {
 		node.Handle(sender, m.E)
 		return nil
 
+	case *CatchupRequest:
+		return node.handleCatchupRequest(m)
+
+	case *CatchupResponse:
+		if len(m.Chunks) != len(m.E) {
+			log.Printf("malformed catchup response: %s", m)
+			return nil
+		}
+		for i, chunk := range m.Chunks {
+			if !currency.VerifyExternalize(m.E[i], chunk) {
+				log.Printf("catchup chunk does not match its externalize: %s", m.E[i])
+				return nil
+			}
+			chunks := make(map[consensus.SlotValue]*currency.LedgerChunk)
+			chunks[chunk.Hash()] = chunk
+			node.Handle(sender, &currency.TransactionMessage{
+				Transactions: []*currency.SignedTransaction{},
+				Chunks:       chunks,
+			})
+			node.Handle(sender, m.E[i])
+		}
+		return nil
+
 	case *currency.AccountMessage:
 		return nil
 
@@ -96,6 +119,33 @@ func (node *Node) handleChainMessage(sender string, message util.Message) util.M
 	}
 }
 
+// handleCatchupRequest returns the chunks for externalized slots, starting
+// at the requested one, or nil if we have none of them.
+func (node *Node) handleCatchupRequest(m *CatchupRequest) util.Message {
+	from := m.FromSlot
+	if from < 1 {
+		from = 1
+	}
+	response := &CatchupResponse{
+		I:      from,
+		Chunks: []*currency.LedgerChunk{},
+		E:      []*consensus.ExternalizeMessage{},
+	}
+	for slot := from; slot < from+MaxCatchupChunks; slot++ {
+		chunk := node.queue.OldChunk(slot)
+		e := node.chain.ExternalizeMessage(slot)
+		if chunk == nil || e == nil {
+			break
+		}
+		response.Chunks = append(response.Chunks, chunk)
+		response.E = append(response.E, e)
+	}
+	if len(response.Chunks) == 0 {
+		return nil
+	}
+	return response
+}
+
 func (node *Node) OutgoingMessages() []util.Message {
 	answer := []util.Message{}
 	sharing := node.queue.SharingMessage()
@@ -110,7 +160,7 @@ func (node *Node) OutgoingMessages() []util.Message {
 
 func (node *Node) Stats() {
 	node.chain.Stats()
-	node.queue.Stats()
+	node.queue.LogStats()
 }
 
 func (node *Node) Log() {
@@ -88,6 +88,74 @@ func TestNodeCatchup(t *testing.T) {
 	}
 }
 
+func TestNodeCatchupRequest(t *testing.T) {
+	kp := util.NewKeyPairFromSecretPhrase("client")
+	kp2 := util.NewKeyPairFromSecretPhrase("bob")
+	qs, names := consensus.MakeTestQuorumSlice(4)
+	nodes := []*Node{}
+	for _, name := range names {
+		node := NewNode(name, qs)
+		node.queue.SetBalance(kp.PublicKey().String(), 100)
+		nodes = append(nodes, node)
+	}
+
+	// Run more rounds than fit in one response, without the last node
+	rounds := MaxCatchupChunks + 2
+	for round := 1; round <= rounds; round++ {
+		tr := &currency.Transaction{
+			From:     kp.PublicKey().String(),
+			Sequence: uint32(round),
+			To:       kp2.PublicKey().String(),
+			Amount:   1,
+			Fee:      1,
+		}
+		m := currency.NewTransactionMessage(tr.SignWith(kp))
+		nodes[0].Handle(kp.PublicKey().String(), m)
+		for i := 0; i < 10; i++ {
+			for _, source := range nodes[:3] {
+				for _, target := range nodes[:3] {
+					if source != target {
+						sendNodeToNodeMessages(source, target, t)
+					}
+				}
+			}
+		}
+	}
+
+	// Nothing is served for slots that have not externalized
+	behind := nodes[3]
+	if nodes[0].Handle(behind.publicKey.String(), &CatchupRequest{FromSlot: rounds + 1}) != nil {
+		t.Fatal("there should be no chunks past the externalized slots")
+	}
+
+	response, ok := nodes[0].Handle(
+		behind.publicKey.String(), &CatchupRequest{FromSlot: 1}).(*CatchupResponse)
+	if !ok || len(response.Chunks) != MaxCatchupChunks {
+		t.Fatalf("expected a response with %d chunks", MaxCatchupChunks)
+	}
+
+	// The last node catches up using only catchup requests
+	for i := 0; i < 10 && behind.Slot() <= rounds; i++ {
+		for _, node := range nodes[:3] {
+			if behind.Slot() > rounds {
+				break
+			}
+			request := &CatchupRequest{FromSlot: behind.Slot()}
+			response := node.Handle(behind.publicKey.String(), util.EncodeThenDecode(request))
+			if response == nil {
+				t.Fatalf("no catchup response for slot %d", behind.Slot())
+			}
+			behind.Handle(node.publicKey.String(), util.EncodeThenDecode(response))
+		}
+	}
+	if behind.Slot() != rounds+1 {
+		t.Fatalf("catchup failed, the node is on slot %d", behind.Slot())
+	}
+	if behind.queue.MaxBalance() != nodes[0].queue.MaxBalance() {
+		t.Fatal("the caught up node should have the same balances")
+	}
+}
+
 func nodeFuzzTest(seed int64, t *testing.T) {
 	initialMoney := uint64(4)
 
@@ -51,7 +51,10 @@ func NewServer(config *ServerConfig) *Server {
 	for _, address := range config.Network.Nodes {
 		peers = append(peers, NewClient(address))
 	}
-	qs := config.Network.QuorumSlice()
+	qs, err := config.Network.QuorumSlice()
+	if err != nil {
+		log.Fatalf("invalid network config: %s", err)
+	}
 
 	// At the start, all money is in the "mint" account
 	node := NewNode(config.KeyPair.PublicKey(), qs)
@@ -0,0 +1,30 @@
+package util
+
+import (
+	"golang.org/x/crypto/sha3"
+)
+
+// A Hasher turns data into a fixed-size digest.
+type Hasher interface {
+	Hash(data []byte) []byte
+}
+
+type sha3Hasher struct{}
+
+func (sha3Hasher) Hash(data []byte) []byte {
+	h := sha3.New512()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// DefaultHasher is what Hash uses. It is sha3-512.
+// Tests can swap in a cheaper or more readable hasher, but should put the
+// old one back when they are done.
+// Key derivation and public key checksums always use sha3, since changing
+// those would change which keys are valid.
+var DefaultHasher Hasher = sha3Hasher{}
+
+// Hash hashes data with DefaultHasher.
+func Hash(data []byte) []byte {
+	return DefaultHasher.Hash(data)
+}
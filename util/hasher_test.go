@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+)
+
+// identityHasher makes hash expectations readable in tests.
+type identityHasher struct{}
+
+func (identityHasher) Hash(data []byte) []byte {
+	return data
+}
+
+// useHasher swaps in h as the DefaultHasher and returns a function that
+// restores the old one.
+func useHasher(h Hasher) func() {
+	old := DefaultHasher
+	DefaultHasher = h
+	return func() {
+		DefaultHasher = old
+	}
+}
+
+func TestHashUsesDefaultHasher(t *testing.T) {
+	if len(Hash([]byte("foo"))) != 64 {
+		t.Fatal("the default hash should be sha3-512")
+	}
+	restore := useHasher(identityHasher{})
+	if string(Hash([]byte("foo"))) != "foo" {
+		t.Fatal("Hash should go through the swapped-in hasher")
+	}
+	restore()
+	if len(Hash([]byte("foo"))) != 64 {
+		t.Fatal("the default hasher should be restored")
+	}
+}
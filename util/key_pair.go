@@ -5,6 +5,11 @@ import (
 	"crypto"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/sha3"
@@ -48,17 +53,109 @@ func (kp *KeyPair) PublicKey() PublicKey {
 	return kp.publicKey
 }
 
-// Interprets the message as utf8, then returns the signature as base64.
+// Derive returns the child key pair with the given index.
+// The child's seed is the hash of the parent's seed and the index, so the
+// same parent and index always give the same child, and a child key does not
+// reveal its parent.
+func (kp *KeyPair) Derive(index uint32) *KeyPair {
+	h := sha3.New512()
+	h.Write(kp.privateKey.Seed())
+	h.Write([]byte("derive"))
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], index)
+	h.Write(buf[:])
+	priv := ed25519.NewKeyFromSeed(h.Sum(nil)[:ed25519.SeedSize])
+	return &KeyPair{
+		publicKey:  GeneratePublicKey(priv.Public().(ed25519.PublicKey)),
+		privateKey: priv,
+	}
+}
+
+// keyPairVersion is the current version of the serialized key pair format.
+const keyPairVersion = 1
+
+// serializedKeyPair is the envelope used to store a key pair.
+// Only the private seed is stored; the rest of the key is derived from it.
+type serializedKeyPair struct {
+	Version   int
+	Seed      string
+	PublicKey string
+}
+
+// Marshal serializes the key pair so that it can be reloaded with LoadKeyPair.
+func (kp *KeyPair) Marshal() ([]byte, error) {
+	return json.Marshal(serializedKeyPair{
+		Version:   keyPairVersion,
+		Seed:      base64.RawStdEncoding.EncodeToString(kp.privateKey.Seed()),
+		PublicKey: kp.publicKey.String(),
+	})
+}
+
+// LoadKeyPair reads a key pair that was serialized with Marshal.
+func LoadKeyPair(data []byte) (*KeyPair, error) {
+	var s serializedKeyPair
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Version != keyPairVersion {
+		return nil, fmt.Errorf("unsupported key pair version: %d", s.Version)
+	}
+	seed, err := base64.RawStdEncoding.DecodeString(s.Seed)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("bad seed length")
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	kp := &KeyPair{
+		publicKey:  GeneratePublicKey(priv.Public().(ed25519.PublicKey)),
+		privateKey: priv,
+	}
+	if kp.publicKey.String() != s.PublicKey {
+		return nil, errors.New("public key does not match the seed")
+	}
+	return kp, nil
+}
+
+// signatureVersion tags the scheme a signature was made with, so that
+// Verify can keep accepting old signatures if the scheme ever changes.
+// Version 1 is ed25519.
+const signatureVersion = "1"
+
+// Interprets the message as utf8, then returns the signature as base64,
+// prefixed with the signature version and a dot.
 func (kp *KeyPair) Sign(message string) string {
 	signature, err := kp.privateKey.Sign(rand.Reader, []byte(message), crypto.Hash(0))
 	if err != nil {
 		panic(err)
 	}
-	return base64.RawStdEncoding.EncodeToString(signature)
+	return signatureVersion + "." + base64.RawStdEncoding.EncodeToString(signature)
+}
+
+// CanonicalSignature returns the tagged form of a signature.
+// Verify accepts legacy signatures with no tag, so the same signature can be
+// written two ways. Anything that stores or compares signatures should
+// canonicalize them first.
+func CanonicalSignature(signature string) string {
+	if strings.Contains(signature, ".") {
+		return signature
+	}
+	return signatureVersion + "." + signature
 }
 
-// message is handled as utf8, the signature is base64.
+// message is handled as utf8, the signature is base64 with a version tag.
+// Signatures with no tag are from before versioning, and are ed25519.
+// The signature bytes are never compared directly; ed25519.Verify does the
+// checking without short-circuiting on secret data.
 func Verify(publicKey PublicKey, message string, signature string) bool {
+	parts := strings.SplitN(signature, ".", 2)
+	if len(parts) == 2 {
+		if parts[0] != signatureVersion {
+			return false
+		}
+		signature = parts[1]
+	}
 	pub := publicKey.WithoutChecksum()
 	if len(pub) != ed25519.PublicKeySize {
 		return false
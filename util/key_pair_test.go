@@ -1,6 +1,8 @@
 package util
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -53,3 +55,109 @@ func TestNewKeyPairFromSecretPhrase(t *testing.T) {
 		}
 	}
 }
+
+func TestKeyPairSerialization(t *testing.T) {
+	kp := NewKeyPair()
+	data, err := kp.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp2, err := LoadKeyPair(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !kp.PublicKey().Equal(kp2.PublicKey()) {
+		t.Fatal("public keys should match")
+	}
+	message := "This is my message. There are many like it, but this one is mine."
+	if kp.Sign(message) != kp2.Sign(message) {
+		t.Fatal("reloaded key pair should make identical signatures")
+	}
+}
+
+func TestLoadKeyPairRejectsGarbage(t *testing.T) {
+	inputs := []string{
+		"",
+		"garbage",
+		`{"Version":2}`,
+		`{"Version":1,"Seed":"c2VlZA"}`,
+	}
+	for _, input := range inputs {
+		if _, err := LoadKeyPair([]byte(input)); err == nil {
+			t.Fatalf("expected LoadKeyPair to reject %q", input)
+		}
+	}
+
+	// A public key that doesn't match the seed should be rejected
+	data, err := NewKeyPair().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s serializedKeyPair
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	s.PublicKey = NewKeyPair().PublicKey().String()
+	data, err = json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeyPair(data); err == nil {
+		t.Fatal("expected a mismatched public key to be rejected")
+	}
+}
+
+func TestSignatureVersions(t *testing.T) {
+	kp := NewKeyPairFromSecretPhrase("versions")
+	message := "a message"
+	sig := kp.Sign(message)
+	if !strings.HasPrefix(sig, signatureVersion+".") {
+		t.Fatalf("signature is not tagged: %s", sig)
+	}
+	if !Verify(kp.PublicKey(), message, sig) {
+		t.Fatal("a tagged signature should verify")
+	}
+
+	legacy := strings.TrimPrefix(sig, signatureVersion+".")
+	if !Verify(kp.PublicKey(), message, legacy) {
+		t.Fatal("a legacy untagged signature should verify")
+	}
+
+	if Verify(kp.PublicKey(), message, "2."+legacy) {
+		t.Fatal("a signature with an unknown version should not verify")
+	}
+}
+
+func TestDerive(t *testing.T) {
+	kp := NewKeyPairFromSecretPhrase("parent")
+	again := NewKeyPairFromSecretPhrase("parent")
+	seen := map[string]bool{kp.PublicKey().String(): true}
+	for i := uint32(0); i < 10; i++ {
+		child := kp.Derive(i)
+		if child.PublicKey() != again.Derive(i).PublicKey() {
+			t.Fatalf("deriving child %d is not deterministic", i)
+		}
+		if seen[child.PublicKey().String()] {
+			t.Fatalf("child %d collides with another key", i)
+		}
+		seen[child.PublicKey().String()] = true
+		sig := child.Sign("message")
+		if !Verify(child.PublicKey(), "message", sig) {
+			t.Fatalf("child %d cannot sign", i)
+		}
+	}
+	if kp.Derive(0).PublicKey() == NewKeyPairFromSecretPhrase("other").Derive(0).PublicKey() {
+		t.Fatal("different parents should have different children")
+	}
+}
+
+func TestCanonicalSignature(t *testing.T) {
+	sig := NewKeyPairFromSecretPhrase("canonical").Sign("message")
+	legacy := strings.TrimPrefix(sig, signatureVersion+".")
+	if CanonicalSignature(legacy) != sig {
+		t.Fatal("a legacy signature should canonicalize to the tagged form")
+	}
+	if CanonicalSignature(sig) != sig {
+		t.Fatal("a tagged signature is already canonical")
+	}
+}
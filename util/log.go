@@ -5,11 +5,19 @@ import (
 )
 
 func Shorten(name string) string {
-	length := len(name)
-	if length > 6 {
-		length = 6
+	return ShortenN(name, 6)
+}
+
+// ShortenN truncates name to at most n bytes.
+// Inputs shorter than n are returned unchanged.
+func ShortenN(name string, n int) string {
+	if n < 0 {
+		n = 0
+	}
+	if len(name) > n {
+		return name[:n]
 	}
-	return name[:length]
+	return name
 }
 
 // Send logging through here so that it's easier to manage
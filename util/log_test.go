@@ -0,0 +1,29 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestShorten(t *testing.T) {
+	key := NewKeyPairFromSecretPhrase("key").PublicKey().String()
+	cases := []struct {
+		input    string
+		n        int
+		expected string
+	}{
+		{"", 6, ""},
+		{"abc", 6, "abc"},
+		{key, 6, key[:6]},
+		{key, 10, key[:10]},
+		{"abc", 0, ""},
+		{"abc", -1, ""},
+	}
+	for _, c := range cases {
+		if ShortenN(c.input, c.n) != c.expected {
+			t.Fatalf("ShortenN(%q, %d) should be %q", c.input, c.n, c.expected)
+		}
+	}
+	if Shorten("") != "" || Shorten("abc") != "abc" || Shorten(key) != key[:6] {
+		t.Fatal("Shorten should truncate to 6")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
 )
 
 type Message interface {
@@ -43,6 +44,26 @@ func RegisterMessageType(m Message) {
 	MessageTypeMap[name] = sv.Type()
 }
 
+// RegisteredMessageTypes returns the names of every registered message type,
+// sorted.
+func RegisteredMessageTypes() []string {
+	answer := []string{}
+	for name, _ := range MessageTypeMap {
+		answer = append(answer, name)
+	}
+	sort.Strings(answer)
+	return answer
+}
+
+// NewMessage creates a zero-valued message of the named type.
+func NewMessage(messageType string) (Message, error) {
+	t, ok := MessageTypeMap[messageType]
+	if !ok {
+		return nil, fmt.Errorf("unregistered message type: %s", messageType)
+	}
+	return reflect.New(t).Interface().(Message), nil
+}
+
 // DecodedMessage is useful for json encoding and decoding, but not necessarily
 // needed outside this file. Try using EncodeMessage and DecodeMessage directly.
 type DecodedMessage struct {
@@ -77,11 +98,10 @@ func DecodeMessage(encoded string) (Message, error) {
 		return nil, err
 	}
 
-	messageType, ok := MessageTypeMap[pdm.T]
-	if !ok {
-		return nil, fmt.Errorf("unregistered message type: %s", pdm.T)
+	m, err := NewMessage(pdm.T)
+	if err != nil {
+		return nil, err
 	}
-	m := reflect.New(messageType).Interface().(Message)
 	err = json.Unmarshal(pdm.M, &m)
 	if err != nil {
 		return nil, err
@@ -90,6 +110,15 @@ func DecodeMessage(encoded string) (Message, error) {
 	return m.(Message), nil
 }
 
+// MessagesEqual returns whether two messages have the same type and the same
+// contents, by comparing their encodings.
+func MessagesEqual(a Message, b Message) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return EncodeMessage(a) == EncodeMessage(b)
+}
+
 // Useful for simulating a network transit
 func EncodeThenDecode(message Message) Message {
 	encoded := EncodeMessage(message)
@@ -31,3 +31,28 @@ func TestMessageEncoding(t *testing.T) {
 		t.Fatalf("m2.Number turned into %d", m2.Number)
 	}
 }
+
+func TestMessageRegistry(t *testing.T) {
+	types := RegisteredMessageTypes()
+	found := map[string]bool{}
+	for i, name := range types {
+		if i > 0 && types[i-1] >= name {
+			t.Fatalf("types are not sorted: %v", types)
+		}
+		found[name] = true
+	}
+	if !found["Testing"] || !found["I"] {
+		t.Fatalf("missing registered types: %v", types)
+	}
+
+	m, err := NewMessage("Testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm, ok := m.(*TestingMessage); !ok || tm.Number != 0 {
+		t.Fatalf("expected a zero TestingMessage but got %+v", m)
+	}
+	if _, err := NewMessage("Bogus"); err == nil {
+		t.Fatal("an unknown message type should be an error")
+	}
+}
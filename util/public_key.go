@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 
@@ -50,8 +51,10 @@ func (pk PublicKey) WithoutChecksum() []byte {
 	return pk[:32]
 }
 
+// Equal compares in constant time. Public keys aren't secret, but keeping
+// comparisons of key material constant-time is a good habit.
 func (pk PublicKey) Equal(other PublicKey) bool {
-	return bytes.Equal(pk[:], other[:])
+	return subtle.ConstantTimeCompare(pk[:], other[:]) == 1
 }
 
 // ReadPublicKey attempts to read a public key from a string format.
@@ -76,3 +79,10 @@ func ReadPublicKey(input string) (PublicKey, error) {
 	}
 	return answer, nil
 }
+
+// Verify checks a signature made by the private key that goes with this
+// public key. No private key material is needed.
+// message is handled as utf8, the signature is base64.
+func (pk PublicKey) Verify(message string, signature string) bool {
+	return Verify(pk, message, signature)
+}
@@ -45,3 +45,32 @@ func TestValidation(t *testing.T) {
 		t.Fatal("WithoutChecksum should be undoable")
 	}
 }
+
+func TestVerifyWithOnlyPublicKey(t *testing.T) {
+	kp := NewKeyPairFromSecretPhrase("verify me")
+	message := "a message"
+	signature := kp.Sign(message)
+
+	pk, err := ReadPublicKey(kp.PublicKey().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pk.Verify(message, signature) {
+		t.Fatal("this should verify")
+	}
+	if pk.Verify("another message", signature) {
+		t.Fatal("this should not verify")
+	}
+}
+
+func TestPublicKeyEqual(t *testing.T) {
+	pk1 := NewKeyPairFromSecretPhrase("one").PublicKey()
+	pk2 := NewKeyPairFromSecretPhrase("one").PublicKey()
+	pk3 := NewKeyPairFromSecretPhrase("two").PublicKey()
+	if !pk1.Equal(pk2) {
+		t.Fatal("keys from the same phrase should be equal")
+	}
+	if pk1.Equal(pk3) || pk3.Equal(pk1) {
+		t.Fatal("keys from different phrases should not be equal")
+	}
+}
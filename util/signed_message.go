@@ -52,7 +52,7 @@ func NewSignedMessageFromSerialized(serialized string) (*SignedMessage, error) {
 	if err != nil {
 		return nil, err
 	}
-	if !Verify(publicKey, ms, signature) {
+	if !publicKey.Verify(ms, signature) {
 		return nil, errors.New("signature failed verification")
 	}
 	m, err := DecodeMessage(ms)
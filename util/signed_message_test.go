@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"log"
 	"testing"
 )
@@ -21,3 +22,28 @@ func TestSignedMessage(t *testing.T) {
 		t.Fatal("sm should equal sm2")
 	}
 }
+
+func TestSignedMessageTampering(t *testing.T) {
+	m := &TestingMessage{Number: 4}
+	kp := NewKeyPairFromSecretPhrase("foo")
+	sm := NewSignedMessage(kp, m)
+	other := NewKeyPairFromSecretPhrase("bar")
+	tampered := []string{
+		// Unsigned
+		"e:" + sm.messageString,
+		// Different message
+		fmt.Sprintf("e:%s:%s:%s", sm.signer, sm.signature,
+			EncodeMessage(&TestingMessage{Number: 5})),
+		// Different signer
+		fmt.Sprintf("e:%s:%s:%s", other.PublicKey().String(), sm.signature,
+			sm.messageString),
+		// Different signature
+		fmt.Sprintf("e:%s:%s:%s", sm.signer, other.Sign(sm.messageString),
+			sm.messageString),
+	}
+	for _, s := range tampered {
+		if _, err := NewSignedMessageFromSerialized(s); err == nil {
+			t.Fatalf("tampered message should be rejected: %s", s)
+		}
+	}
+}